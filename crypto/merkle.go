@@ -137,6 +137,28 @@ func MerkleProof(b []byte, proofIndex uint64) (base []byte, hashSet []Hash) {
 	return base, hashSet
 }
 
+// ProofLength returns the number of hashes in the hash set of a Merkle proof
+// for segment 'proofIndex' of a tree with 'numSegments' segments.
+func ProofLength(numSegments, proofIndex uint64) (length uint64) {
+	for numSegments > 1 {
+		// Each hash in the proof covers a sibling subtree. The tree splits
+		// into the largest power of two smaller than numSegments on the left
+		// and the remainder on the right.
+		left := uint64(1)
+		for left*2 < numSegments {
+			left *= 2
+		}
+		if proofIndex < left {
+			numSegments = left
+		} else {
+			numSegments -= left
+			proofIndex -= left
+		}
+		length++
+	}
+	return length
+}
+
 // VerifySegment will verify that a segment, given the proof, is a part of a
 // Merkle root.
 func VerifySegment(base []byte, hashSet []Hash, numSegments, proofIndex uint64, root Hash) bool {
@@ -148,3 +170,70 @@ func VerifySegment(base []byte, hashSet []Hash, numSegments, proofIndex uint64,
 	}
 	return merkletree.VerifyProof(NewHash(), root[:], proofSet, proofIndex, numSegments)
 }
+
+// VerifySegmentStream is equivalent to VerifySegment, but walks the hash set
+// in place instead of copying it into a proof set, so verification uses a
+// constant amount of memory regardless of the length of the hash set. The
+// hash set is consumed from the bottom of the tree upwards, which is the
+// order produced by MerkleProof.
+func VerifySegmentStream(base []byte, hashSet []Hash, numSegments, proofIndex uint64, root Hash) bool {
+	if proofIndex >= numSegments {
+		return false
+	}
+
+	// sum holds the running hash, and buf holds the preimage of the next
+	// node: a one byte prefix followed by the two children.
+	var sum Hash
+	var buf [1 + 2*HashSize]byte
+	h := NewHash()
+	h.Write([]byte{0})
+	h.Write(base)
+	h.Sum(sum[:0])
+	node := func(left, right Hash) {
+		buf[0] = 1
+		copy(buf[1:], left[:])
+		copy(buf[1+HashSize:], right[:])
+		h.Reset()
+		h.Write(buf[:])
+		h.Sum(sum[:0])
+	}
+
+	// Climb through the perfect subtrees that contain the segment. At each
+	// level the position of the segment within the subtree determines which
+	// side the sibling is on.
+	height := uint64(0)
+	stableEnd := proofIndex
+	for height < 63 {
+		subtreeStart := (proofIndex >> (height + 1)) << (height + 1)
+		subtreeEnd := subtreeStart + 1<<(height+1) - 1
+		if subtreeEnd >= numSegments {
+			break
+		}
+		if height >= uint64(len(hashSet)) {
+			return false
+		}
+		stableEnd = subtreeEnd
+		if proofIndex-subtreeStart < 1<<height {
+			node(sum, hashSet[height])
+		} else {
+			node(hashSet[height], sum)
+		}
+		height++
+	}
+
+	// If the segment is not in the rightmost subtree, the subtrees to its
+	// right have been collapsed into a single hash on the right.
+	if stableEnd != numSegments-1 {
+		if height >= uint64(len(hashSet)) {
+			return false
+		}
+		node(sum, hashSet[height])
+		height++
+	}
+
+	// All remaining hashes are subtrees to the left.
+	for ; height < uint64(len(hashSet)); height++ {
+		node(hashSet[height], sum)
+	}
+	return sum == root
+}
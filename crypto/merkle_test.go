@@ -76,6 +76,77 @@ func TestNonMultipleLeafSizeStorageProof(t *testing.T) {
 	}
 }
 
+// TestProofLength checks that ProofLength matches the length of the hash sets
+// produced by MerkleProof.
+func TestProofLength(t *testing.T) {
+	for numSegments := uint64(1); numSegments <= 33; numSegments++ {
+		data := make([]byte, numSegments*SegmentSize)
+		rand.Read(data)
+		for i := uint64(0); i < numSegments; i++ {
+			_, hashSet := MerkleProof(data, i)
+			if ProofLength(numSegments, i) != uint64(len(hashSet)) {
+				t.Errorf("wrong proof length for segment %v of %v: expected %v, got %v", i, numSegments, len(hashSet), ProofLength(numSegments, i))
+			}
+		}
+	}
+}
+
+// TestVerifySegmentStream checks that VerifySegmentStream agrees with
+// VerifySegment on both valid and invalid proofs.
+func TestVerifySegmentStream(t *testing.T) {
+	for numSegments := uint64(1); numSegments <= 33; numSegments++ {
+		data := make([]byte, numSegments*SegmentSize-5)
+		rand.Read(data)
+		root := MerkleRoot(data)
+		for i := uint64(0); i < numSegments; i++ {
+			base, hashSet := MerkleProof(data, i)
+			if !VerifySegmentStream(base, hashSet, numSegments, i, root) {
+				t.Errorf("proof for segment %v of %v did not verify", i, numSegments)
+			}
+
+			// Proofs checked against the wrong index, or with a hash set that
+			// is too short or too long, should fail in both verifiers.
+			wrongIndex := (i + 1) % numSegments
+			if numSegments > 1 && VerifySegmentStream(base, hashSet, numSegments, wrongIndex, root) != VerifySegment(base, hashSet, numSegments, wrongIndex, root) {
+				t.Errorf("verifiers disagree on segment %v of %v checked at index %v", i, numSegments, wrongIndex)
+			}
+			if len(hashSet) > 0 && VerifySegmentStream(base, hashSet[:len(hashSet)-1], numSegments, i, root) {
+				t.Error("verified a proof with a truncated hash set")
+			}
+			if VerifySegmentStream(base, append(hashSet, Hash{}), numSegments, i, root) {
+				t.Error("verified a proof with an extended hash set")
+			}
+		}
+		if VerifySegmentStream(nil, nil, numSegments, numSegments, root) {
+			t.Error("verified a proof for an out of range segment")
+		}
+	}
+}
+
+// TestVerifySegmentStreamAllocs checks that the memory used by
+// VerifySegmentStream does not grow with the size of the hash set.
+func TestVerifySegmentStreamAllocs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	allocs := func(numSegments uint64) float64 {
+		data := make([]byte, numSegments*SegmentSize)
+		rand.Read(data)
+		root := MerkleRoot(data)
+		index := numSegments / 3
+		base, hashSet := MerkleProof(data, index)
+		return testing.AllocsPerRun(50, func() {
+			if !VerifySegmentStream(base, hashSet, numSegments, index, root) {
+				t.Fatal("proof did not verify")
+			}
+		})
+	}
+	small, large := allocs(4), allocs(1<<16)
+	if large > small {
+		t.Errorf("allocations grew with the hash set: %v for a small proof, %v for a large one", small, large)
+	}
+}
+
 // TestCachedTree tests the cached tree functions of the package.
 func TestCachedTree(t *testing.T) {
 	if testing.Short() {
@@ -46,10 +46,29 @@ var (
 	// should be handled by the module, and not reported to the user.
 	ErrInvalidConsensusChangeID = errors.New("consensus subscription has invalid id - files are inconsistent")
 
+	// ErrInvalidStorageProof indicates that a storage proof does not prove the
+	// segment requested by the consensus set.
+	ErrInvalidStorageProof = errors.New("provided storage proof is invalid")
+
 	// ErrNonExtendingBlock indicates that a block is valid but does not result
 	// in a fork that is the heaviest known fork - the consensus set has not
 	// changed as a result of seeing the block.
 	ErrNonExtendingBlock = errors.New("block does not extend the longest fork")
+
+	// ErrTerminatedFileContract indicates that a storage proof segment was
+	// requested for a file contract that was recently closed, either by a
+	// storage proof or by its proof window expiring.
+	ErrTerminatedFileContract = errors.New("file contract has already been terminated")
+
+	// ErrUnfinishedFileContract indicates that a storage proof was requested
+	// or submitted before the proof window of the file contract opened.
+	ErrUnfinishedFileContract = errors.New("file contract window has not yet openend")
+
+	// ErrUnrecognizedFileContractID indicates that a storage proof refers to a
+	// file contract that is not in the consensus set. File contracts are
+	// removed once a storage proof has been accepted for them, so submitting a
+	// second proof for the same contract also results in this error.
+	ErrUnrecognizedFileContractID = errors.New("cannot fetch storage proof segment for unknown file contract")
 )
 
 type (
@@ -3,9 +3,11 @@ package consensus
 import (
 	"bytes"
 	"errors"
+	"io"
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 
@@ -14,6 +16,7 @@ import (
 
 var (
 	errDoSBlock        = errors.New("block is known to be invalid")
+	errFrozen          = errors.New("consensus set is frozen")
 	errNoBlockMap      = errors.New("block map is not in database")
 	errInconsistentSet = errors.New("consensus set is not in a consistent state")
 	errOrphan          = errors.New("block has no known parent")
@@ -140,32 +143,15 @@ func (cs *ConsensusSet) validateHeader(tx dbTx, h types.BlockHeader) error {
 func (cs *ConsensusSet) addBlockToTree(b types.Block) (ce changeEntry, err error) {
 	var nonExtending bool
 	err = cs.db.Update(func(tx *bolt.Tx) error {
-		pb, err := getBlockMap(tx, b.ParentID)
-		if build.DEBUG && err != nil {
-			panic(err)
-		}
-		currentNode := currentProcessedBlock(tx)
-		newNode := cs.newChild(tx, pb, b)
-
 		// modules.ErrNonExtendingBlock should be returned if the block does
 		// not extend the current blockchain, however the changes from newChild
 		// should be committed (which means 'nil' must be returned). A flag is
 		// set to indicate that modules.ErrNonExtending should be returned.
-		nonExtending = !newNode.heavierThan(currentNode)
-		if nonExtending {
-			return nil
-		}
-		var revertedBlocks, appliedBlocks []*processedBlock
-		revertedBlocks, appliedBlocks, err = cs.forkBlockchain(tx, newNode)
-		if err != nil {
+		var err error
+		ce, nonExtending, err = cs.addBlockToTx(tx, b)
+		if err != nil || nonExtending {
 			return err
 		}
-		for _, rn := range revertedBlocks {
-			ce.RevertedBlocks = append(ce.RevertedBlocks, rn.Block.ID())
-		}
-		for _, an := range appliedBlocks {
-			ce.AppliedBlocks = append(ce.AppliedBlocks, an.Block.ID())
-		}
 		// To have correct error handling, appendChangeLog must be called
 		// before appending to the in-memory changelog. If this call fails, the
 		// change is going to be reverted, but the in-memory changelog is not
@@ -175,11 +161,7 @@ func (cs *ConsensusSet) addBlockToTree(b types.Block) (ce changeEntry, err error
 		// filesystem error), the in-memory changelog will be incorrect anyway.
 		// Restarting Sia will fix it. The in-memory changelog is being phased
 		// out.
-		err = appendChangeLog(tx, ce)
-		if err != nil {
-			return err
-		}
-		return nil
+		return appendChangeLog(tx, ce)
 	})
 	if err != nil {
 		return changeEntry{}, err
@@ -187,9 +169,139 @@ func (cs *ConsensusSet) addBlockToTree(b types.Block) (ce changeEntry, err error
 	if nonExtending {
 		return changeEntry{}, modules.ErrNonExtendingBlock
 	}
+	if len(ce.RevertedBlocks) > 0 {
+		cs.log.Debugf("Reorg: reverted %v blocks and applied %v blocks, new current block %v", len(ce.RevertedBlocks), len(ce.AppliedBlocks), ce.AppliedBlocks[len(ce.AppliedBlocks)-1])
+	}
 	return ce, nil
 }
 
+// addBlockToTx inserts a block into the block tree using an existing database
+// transaction, forking the blockchain if the block makes a heavier fork. The
+// block is still added to the tree if it does not extend the longest fork, in
+// which case 'nonExtending' is set. If an error is returned, the transaction
+// may have been partially modified and must be rolled back.
+func (cs *ConsensusSet) addBlockToTx(tx *bolt.Tx, b types.Block) (ce changeEntry, nonExtending bool, err error) {
+	pb, err := getBlockMap(tx, b.ParentID)
+	if build.DEBUG && err != nil {
+		panic(err)
+	}
+	currentNode := currentProcessedBlock(tx)
+	newNode := cs.newChild(tx, pb, b)
+	if !newNode.heavierThan(currentNode) {
+		return changeEntry{}, true, nil
+	}
+	revertedBlocks, appliedBlocks, err := cs.forkBlockchain(tx, newNode)
+	if err != nil {
+		return changeEntry{}, false, err
+	}
+	for _, rn := range revertedBlocks {
+		ce.RevertedBlocks = append(ce.RevertedBlocks, rn.Block.ID())
+	}
+	for _, an := range appliedBlocks {
+		ce.AppliedBlocks = append(ce.AppliedBlocks, an.Block.ID())
+	}
+	return ce, false, nil
+}
+
+// addBlocksToTree adds a run of blocks to the block tree using a single
+// database transaction, so the database and the block path are shared by the
+// whole run instead of being set up again for every block. Blocks that are
+// already known or that do not extend the longest fork are skipped. The run
+// stops at the first invalid block, and the changes made by the blocks before
+// it are merged into a single change entry. The number of blocks that extended
+// the longest fork is returned along with the error that stopped the run, if
+// any.
+func (cs *ConsensusSet) addBlocksToTree(blocks []types.Block) (ce changeEntry, accepted int, err error) {
+	// A block that fails validation leaves the database untouched, so the
+	// blocks before it are committed and the validation error is kept in
+	// 'runErr'. A block that fails while the blockchain is being forked may
+	// leave the database partially modified, so the error is returned to
+	// bolt, which rolls back the whole run. 'added' counts the blocks that
+	// were processed before the run stopped.
+	var added int
+	var runErr error
+	addRun := func(blocks []types.Block) error {
+		return cs.db.Update(func(tx *bolt.Tx) error {
+			ce, accepted, added, runErr = changeEntry{}, 0, 0, nil
+			if inconsistencyDetected(tx) {
+				runErr = errInconsistentSet
+				return nil
+			}
+			for _, b := range blocks {
+				err := cs.validateHeaderAndBlock(boltTxWrapper{tx}, b)
+				if err == modules.ErrBlockKnown {
+					added++
+					continue
+				} else if err == errFutureTimestamp {
+					go cs.threadedSleepOnFutureBlock(b)
+				}
+				if err != nil {
+					runErr = err
+					break
+				}
+
+				bce, nonExtending, err := cs.addBlockToTx(tx, b)
+				if err != nil {
+					return err
+				}
+				added++
+				if nonExtending {
+					continue
+				}
+				accepted++
+				ce = appendChangeEntry(ce, bce)
+			}
+			if len(ce.AppliedBlocks) == 0 {
+				return nil
+			}
+			return appendChangeLog(tx, ce)
+		})
+	}
+
+	err = addRun(blocks)
+	if err != nil {
+		// The run was rolled back. Every block before the one that failed is
+		// valid, so those blocks are added again on their own.
+		forkErr := err
+		err = addRun(blocks[:added])
+		if err != nil {
+			return changeEntry{}, 0, err
+		}
+		return ce, accepted, forkErr
+	}
+	return ce, accepted, runErr
+}
+
+// appendChangeEntry extends the change entry 'ce' with the change entry
+// 'next', which happened after it. Blocks that were applied by 'ce' and then
+// reverted by 'next' cancel out.
+func appendChangeEntry(ce, next changeEntry) changeEntry {
+	for _, id := range next.RevertedBlocks {
+		n := len(ce.AppliedBlocks)
+		if n == 0 {
+			ce.RevertedBlocks = append(ce.RevertedBlocks, id)
+			continue
+		}
+		if build.DEBUG && ce.AppliedBlocks[n-1] != id {
+			panic("change entries are not contiguous")
+		}
+		ce.AppliedBlocks = ce.AppliedBlocks[:n-1]
+	}
+	ce.AppliedBlocks = append(ce.AppliedBlocks, next.AppliedBlocks...)
+	return ce
+}
+
+// threadedSleepOnFutureBlock waits until a block that was too far in the
+// future to be accepted is no longer too far in the future, and then tries to
+// accept the block.
+func (cs *ConsensusSet) threadedSleepOnFutureBlock(b types.Block) {
+	time.Sleep(time.Duration(b.Timestamp-(types.CurrentTimestamp()+types.FutureThreshold)) * time.Second)
+	err := cs.AcceptBlock(b)
+	if err != nil {
+		cs.log.Debugln("WARN: failed to accept a future block:", err)
+	}
+}
+
 // managedAcceptBlock will try to add a block to the consensus set. If the
 // block does not extend the longest currently known chain, an error is
 // returned but the block is still kept in memory. If the block extends a fork
@@ -206,6 +318,12 @@ func (cs *ConsensusSet) managedAcceptBlock(b types.Block) error {
 	// failure to unlock before returning an error will cause a deadlock.
 	cs.mu.Lock()
 
+	// Do not accept any blocks while the consensus set is frozen.
+	if cs.frozen {
+		cs.mu.Unlock()
+		return errFrozen
+	}
+
 	// Start verification inside of a bolt View tx.
 	err := cs.db.View(func(tx *bolt.Tx) error {
 		// Do not accept a block if the database is inconsistent.
@@ -235,13 +353,7 @@ func (cs *ConsensusSet) managedAcceptBlock(b types.Block) error {
 			// over which we would evict the block furthest in the future before adding
 			// a new block to the cache.
 			if err == errFutureTimestamp {
-				go func() {
-					time.Sleep(time.Duration(b.Timestamp-(types.CurrentTimestamp()+types.FutureThreshold)) * time.Second)
-					err := cs.AcceptBlock(b)
-					if err != nil {
-						cs.log.Debugln("WARN: failed to accept a future block:", err)
-					}
-				}()
+				go cs.threadedSleepOnFutureBlock(b)
 			}
 			return err
 		}
@@ -275,6 +387,37 @@ func (cs *ConsensusSet) managedAcceptBlock(b types.Block) error {
 	return nil
 }
 
+// managedAcceptBlocks adds a contiguous run of blocks to the consensus set,
+// stopping at the first invalid block. Blocks that are already known or that
+// do not extend the longest fork are skipped. The whole run is added under one
+// lock and one database transaction, and subscribers receive a single update
+// covering every block in the run. The number of blocks that extended the
+// longest fork is returned.
+func (cs *ConsensusSet) managedAcceptBlocks(blocks []types.Block) (accepted int, err error) {
+	// Grab a lock on the consensus set. Lock is demoted later in the function,
+	// failure to unlock before returning an error will cause a deadlock.
+	cs.mu.Lock()
+
+	// Do not accept any blocks while the consensus set is frozen.
+	if cs.frozen {
+		cs.mu.Unlock()
+		return 0, errFrozen
+	}
+
+	changeEntry, accepted, err := cs.addBlocksToTree(blocks)
+	if len(changeEntry.RevertedBlocks) > 0 {
+		cs.log.Debugf("Reorg: reverted %v blocks and applied %v blocks, new current block %v", len(changeEntry.RevertedBlocks), len(changeEntry.AppliedBlocks), changeEntry.AppliedBlocks[len(changeEntry.AppliedBlocks)-1])
+	}
+
+	// Updates complete, demote the lock.
+	cs.mu.Demote()
+	defer cs.mu.DemotedUnlock()
+	if len(changeEntry.AppliedBlocks) > 0 {
+		cs.readlockUpdateSubscribers(changeEntry)
+	}
+	return accepted, err
+}
+
 // AcceptBlock will try to add a block to the consensus set. If the block does
 // not extend the longest currently known chain, an error is returned but the
 // block is still kept in memory. If the block extends a fork such that the
@@ -300,3 +443,41 @@ func (cs *ConsensusSet) AcceptBlock(b types.Block) error {
 	go cs.gateway.Broadcast("RelayHeader", b.Header(), relayHeaderPeers)
 	return nil
 }
+
+// AcceptBlocks adds a contiguous run of blocks to the consensus set, stopping
+// at the first invalid block and leaving the consensus set at the last valid
+// block. Blocks that are already known or that do not extend the longest fork
+// are skipped. The number of blocks that extended the longest fork is returned
+// along with the error that stopped the run, if any. The run is added in a
+// single database transaction, and subscribers receive one consensus change
+// for the whole run. Unlike AcceptBlock, the blocks are not relayed to peers.
+func (cs *ConsensusSet) AcceptBlocks(blocks []types.Block) (int, error) {
+	return cs.managedAcceptBlocks(blocks)
+}
+
+// AcceptBlockStream reads length-prefixed blocks, as written by
+// encoding.WriteObject, from the reader and adds them to the consensus set
+// with the same rules as AcceptBlocks. Blocks are decoded one at a time, so
+// the stream is never buffered in full. Reading stops cleanly at the end of
+// the stream, and stops with an error at the first block that cannot be
+// decoded or is invalid. The number of blocks that extended the longest fork
+// is returned.
+func (cs *ConsensusSet) AcceptBlockStream(r io.Reader) (accepted int, err error) {
+	for {
+		var b types.Block
+		err = encoding.ReadObject(r, &b, types.BlockSizeLimit)
+		if err == io.EOF {
+			return accepted, nil
+		} else if err != nil {
+			return accepted, err
+		}
+
+		err = cs.managedAcceptBlock(b)
+		if err == modules.ErrNonExtendingBlock || err == modules.ErrBlockKnown {
+			continue
+		} else if err != nil {
+			return accepted, err
+		}
+		accepted++
+	}
+}
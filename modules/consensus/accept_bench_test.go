@@ -175,3 +175,54 @@ func BenchmarkAcceptSmallBlocks(b *testing.B) {
 		b.StopTimer()
 	}
 }
+
+// BenchmarkAcceptBlocks measures how quickly a run of 1000 empty blocks is
+// integrated into a blank consensus set by AcceptBlocks.
+func BenchmarkAcceptBlocks(b *testing.B) {
+	cst, err := createConsensusSetTester("BenchmarkAcceptBlocks")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Mine the blocks that will be submitted.
+	for cst.cs.dbBlockHeight() < 1000 {
+		_, err := cst.miner.AddBlock()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	var blocks []types.Block
+	for i := types.BlockHeight(1); i <= 1000; i++ {
+		block, exists := cst.cs.BlockAtHeight(i)
+		if !exists {
+			b.Fatal("missing block at height", i)
+		}
+		blocks = append(blocks, block)
+	}
+
+	b.ResetTimer()
+	for j := 0; j < b.N; j++ {
+		// Create a blank consensus set. (untimed)
+		b.StopTimer()
+		testdir := build.TempDir(modules.ConsensusDir, "BenchmarkAcceptBlocks - 2")
+		g, err := gateway.New("localhost:0", filepath.Join(testdir, modules.GatewayDir))
+		if err != nil {
+			b.Fatal(err)
+		}
+		cs, err := New(g, filepath.Join(testdir, modules.ConsensusDir))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		// Submit the blocks. (timed)
+		b.StartTimer()
+		_, err = cs.AcceptBlocks(blocks)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		cs.Close()
+		g.Close()
+	}
+}
@@ -1,9 +1,12 @@
 package consensus
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -175,6 +178,35 @@ func TestIntegrationSimpleReorg(t *testing.T) {
 	rs.fullReorg()
 }
 
+// TestIntegrationReorgLogging checks that a reorg is written to the consensus
+// log.
+func TestIntegrationReorgLogging(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rs := createReorgSets("TestIntegrationReorgLogging")
+	defer rs.Close()
+
+	// Capture the log of cstMain in a buffer.
+	err := rs.cstMain.cs.log.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	rs.cstMain.cs.log = persist.NewLogger(&buf)
+
+	rs.cstMain.mineSiacoins()
+	if strings.Contains(buf.String(), "Reorg") {
+		t.Fatal("reorg logged without a reorg")
+	}
+	rs.save()
+	rs.extend()
+	if !strings.Contains(buf.String(), "Reorg: reverted") {
+		t.Error("reorg was not logged:", buf.String())
+	}
+}
+
 // TestIntegrationSiacoinReorg tries to reorganize a siacoin output block out
 // of, and then back into, the consensus set.
 func TestIntegrationSiacoinReorg(t *testing.T) {
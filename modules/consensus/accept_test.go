@@ -3,9 +3,12 @@ package consensus
 import (
 	"bytes"
 	"errors"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -532,6 +535,64 @@ func TestIntegrationDoSBlockHandling(t *testing.T) {
 	}
 }
 
+// TestIntegrationFileContractFunding checks that a block is rejected if it
+// creates a file contract that is not fully backed by siacoin inputs, and
+// accepted if the contract is funded exactly.
+func TestIntegrationFileContractFunding(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestIntegrationFileContractFunding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// contractBlock returns a solved block containing a file contract with
+	// the given payout, funded by 'funding' siacoins.
+	payout := types.NewCurrency64(400e6)
+	contractBlock := func(funding types.Currency) types.Block {
+		height := cst.cs.dbBlockHeight()
+		txnBuilder := cst.wallet.StartTransaction()
+		err := txnBuilder.FundSiacoins(funding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txnBuilder.AddFileContract(types.FileContract{
+			WindowStart:        height + 2,
+			WindowEnd:          height + 3,
+			Payout:             payout,
+			ValidProofOutputs:  []types.SiacoinOutput{{Value: types.PostTax(height, payout)}},
+			MissedProofOutputs: []types.SiacoinOutput{{Value: types.PostTax(height, payout)}},
+		})
+		txnSet, err := txnBuilder.Sign(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, target, err := cst.miner.BlockForWork()
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.Transactions = append(block.Transactions, txnSet...)
+		solved, _ := cst.miner.SolveBlock(block, target)
+		return solved
+	}
+
+	// A contract funded with one hasting less than its payout would mint
+	// siacoins, and must be rejected.
+	err = cst.cs.AcceptBlock(contractBlock(payout.Sub(types.NewCurrency64(1))))
+	if err != errSiacoinInputOutputMismatch {
+		t.Fatalf("expected %v, got %v", errSiacoinInputOutputMismatch, err)
+	}
+
+	// A contract funded with exactly its payout is accepted.
+	err = cst.cs.AcceptBlock(contractBlock(payout))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 // TestBlockKnownHandling submits known blocks to the consensus set.
 func TestBlockKnownHandling(t *testing.T) {
 	if testing.Short() {
@@ -831,6 +892,335 @@ func TestBuriedBadTransaction(t *testing.T) {
 	}
 }
 
+// TestIntegrationReplayChain replays a chain containing file contracts and
+// storage proofs into a blank consensus set, which runs full validation and
+// maintenance on every block, and then checks that a block containing an
+// invalid storage proof is rejected.
+func TestIntegrationReplayChain(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestIntegrationReplayChain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Build a chain with one proven and one expired file contract.
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provenID, _ := cst.addFileContract(file, types.NewCurrency64(400e6))
+	cst.submitStorageProof(provenID, file)
+	_, expiredFC := cst.addFileContract(file, types.NewCurrency64(400e6))
+	for cst.cs.dbBlockHeight() < expiredFC.WindowEnd {
+		_, err = cst.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Replay the chain into a blank consensus set.
+	replay, err := blankConsensusSetTester("TestIntegrationReplayChain - replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	for height := types.BlockHeight(1); height <= cst.cs.dbBlockHeight(); height++ {
+		b, exists := cst.cs.BlockAtHeight(height)
+		if !exists {
+			t.Fatal("missing block at height", height)
+		}
+		err = replay.cs.AcceptBlock(b)
+		if err != nil {
+			t.Fatal("valid block rejected during replay:", err)
+		}
+	}
+	if replay.cs.dbConsensusChecksum() != cst.cs.dbConsensusChecksum() {
+		t.Fatal("replayed consensus set does not match the original")
+	}
+
+	// Create a block with an invalid storage proof for a new file contract.
+	fcid, _ := cst.addFileContract(file, types.NewCurrency64(400e6))
+	b, exists := cst.cs.BlockAtHeight(cst.cs.dbBlockHeight())
+	if !exists {
+		t.Fatal("missing current block")
+	}
+	err = replay.cs.AcceptBlock(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := cst.storageProof(fcid, file)
+	sp.Segment[0]++
+	block, target, err := cst.miner.BlockForWork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Transactions = append(block.Transactions, types.Transaction{StorageProofs: []types.StorageProof{sp}})
+	badBlock, _ := cst.miner.SolveBlock(block, target)
+	err = replay.cs.AcceptBlock(badBlock)
+	if err != modules.ErrInvalidStorageProof {
+		t.Error("expecting ErrInvalidStorageProof, got", err)
+	}
+}
+
+// TestAcceptBlocks checks that AcceptBlocks applies a run of blocks and stops
+// at the first invalid block.
+func TestAcceptBlocks(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestAcceptBlocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+	replay, err := blankConsensusSetTester("TestAcceptBlocks - replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+
+	for cst.cs.dbBlockHeight() < 10 {
+		_, err := cst.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var blocks []types.Block
+	for height := types.BlockHeight(1); height <= cst.cs.dbBlockHeight(); height++ {
+		b, exists := cst.cs.BlockAtHeight(height)
+		if !exists {
+			t.Fatal("missing block at height", height)
+		}
+		blocks = append(blocks, b)
+	}
+
+	// Submit the blocks with an invalid block in the middle.
+	badBlocks := append([]types.Block(nil), blocks...)
+	badBlocks[5].MinerPayouts = nil
+	accepted, err := replay.cs.AcceptBlocks(badBlocks)
+	if err == nil {
+		t.Fatal("invalid block was accepted")
+	}
+	if accepted != 5 || replay.cs.dbBlockHeight() != 5 {
+		t.Fatal("AcceptBlocks did not stop at the invalid block:", accepted, replay.cs.dbBlockHeight())
+	}
+
+	// Submit the whole chain. The blocks that were already accepted should be
+	// skipped.
+	accepted, err = replay.cs.AcceptBlocks(blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted != len(blocks)-5 {
+		t.Error("wrong number of blocks accepted:", accepted)
+	}
+	if replay.cs.dbConsensusChecksum() != cst.cs.dbConsensusChecksum() {
+		t.Error("consensus sets do not match after AcceptBlocks")
+	}
+}
+
+// TestAcceptBlocksSingleUpdate checks that subscribers receive a single
+// consensus change for a run of blocks added by AcceptBlocks.
+func TestAcceptBlocksSingleUpdate(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestAcceptBlocksSingleUpdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+	replay, err := blankConsensusSetTester("TestAcceptBlocksSingleUpdate - replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+
+	var blocks []types.Block
+	for height := types.BlockHeight(1); height <= cst.cs.dbBlockHeight(); height++ {
+		b, exists := cst.cs.BlockAtHeight(height)
+		if !exists {
+			t.Fatal("missing block at height", height)
+		}
+		blocks = append(blocks, b)
+	}
+	ms := newMockSubscriber()
+	err = replay.cs.ConsensusSetSubscribe(&ms, modules.ConsensusChangeBeginning)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := len(ms.updates)
+
+	_, err = replay.cs.AcceptBlocks(blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms.updates) != updates+1 {
+		t.Fatal("expecting one consensus change for the run, got", len(ms.updates)-updates)
+	}
+	cc := ms.updates[len(ms.updates)-1]
+	if len(cc.RevertedBlocks) != 0 || len(cc.AppliedBlocks) != len(blocks) {
+		t.Error("consensus change does not cover the run:", len(cc.RevertedBlocks), len(cc.AppliedBlocks))
+	}
+	for i, b := range cc.AppliedBlocks {
+		if b.ID() != blocks[i].ID() {
+			t.Fatal("consensus change applies the wrong block at index", i)
+		}
+	}
+}
+
+// TestAcceptBlocksRollback checks that AcceptBlocks keeps the blocks before a
+// block that fails while it is being applied, rather than during validation.
+func TestAcceptBlocksRollback(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestAcceptBlocksRollback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+	replay, err := blankConsensusSetTester("TestAcceptBlocksRollback - replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+
+	var blocks []types.Block
+	for height := types.BlockHeight(1); height <= cst.cs.dbBlockHeight(); height++ {
+		b, exists := cst.cs.BlockAtHeight(height)
+		if !exists {
+			t.Fatal("missing block at height", height)
+		}
+		blocks = append(blocks, b)
+	}
+
+	// End the run with a block that spends a siacoin output that does not
+	// exist, which is only caught when the block is applied.
+	block, target, err := cst.miner.BlockForWork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Transactions = append(block.Transactions, types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID{1}}},
+	})
+	badBlock, _ := cst.miner.SolveBlock(block, target)
+
+	accepted, err := replay.cs.AcceptBlocks(append(blocks, badBlock))
+	if err != errMissingSiacoinOutput {
+		t.Fatal("expecting errMissingSiacoinOutput, got", err)
+	}
+	if accepted != len(blocks) {
+		t.Error("wrong number of blocks accepted:", accepted)
+	}
+	if replay.cs.dbConsensusChecksum() != cst.cs.dbConsensusChecksum() {
+		t.Error("consensus set does not match the blocks before the invalid block")
+	}
+	err = replay.cs.VerifyInvariants()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestAppendChangeEntry checks that blocks applied by one change entry and
+// reverted by the next cancel out.
+func TestAppendChangeEntry(t *testing.T) {
+	a, b, c, d := types.BlockID{1}, types.BlockID{2}, types.BlockID{3}, types.BlockID{4}
+	ce := changeEntry{AppliedBlocks: []types.BlockID{a, b}}
+	ce = appendChangeEntry(ce, changeEntry{RevertedBlocks: []types.BlockID{b}, AppliedBlocks: []types.BlockID{c}})
+	expected := changeEntry{AppliedBlocks: []types.BlockID{a, c}}
+	if !reflect.DeepEqual(ce, expected) {
+		t.Error("change entries were not merged correctly:", ce)
+	}
+
+	// Reverting past the blocks applied by the first entry should revert the
+	// blocks below it.
+	ce = appendChangeEntry(ce, changeEntry{RevertedBlocks: []types.BlockID{c, a, d}, AppliedBlocks: []types.BlockID{b}})
+	expected = changeEntry{RevertedBlocks: []types.BlockID{d}, AppliedBlocks: []types.BlockID{b}}
+	if !reflect.DeepEqual(ce, expected) {
+		t.Error("change entries were not merged correctly:", ce)
+	}
+}
+
+// TestAcceptBlockStream checks that AcceptBlockStream applies the blocks in a
+// stream, and stops at a block that cannot be decoded.
+func TestAcceptBlockStream(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestAcceptBlockStream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+	replay, err := blankConsensusSetTester("TestAcceptBlockStream - replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	corrupt, err := blankConsensusSetTester("TestAcceptBlockStream - corrupt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer corrupt.Close()
+
+	for cst.cs.dbBlockHeight() < 10 {
+		_, err := cst.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Write the chain to a stream, and a copy of the stream where the length
+	// prefix of the sixth block is corrupted.
+	var stream, corruptStream bytes.Buffer
+	for height := types.BlockHeight(1); height <= cst.cs.dbBlockHeight(); height++ {
+		b, exists := cst.cs.BlockAtHeight(height)
+		if !exists {
+			t.Fatal("missing block at height", height)
+		}
+		err = encoding.WriteObject(&stream, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if height == 6 {
+			err = encoding.WritePrefix(&corruptStream, encoding.EncUint64(^uint64(0)))
+		} else {
+			err = encoding.WriteObject(&corruptStream, b)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	accepted, err := replay.cs.AcceptBlockStream(&stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted != int(cst.cs.dbBlockHeight()) {
+		t.Error("wrong number of blocks accepted:", accepted)
+	}
+	if replay.cs.dbConsensusChecksum() != cst.cs.dbConsensusChecksum() {
+		t.Error("consensus sets do not match after AcceptBlockStream")
+	}
+
+	accepted, err = corrupt.cs.AcceptBlockStream(&corruptStream)
+	if err == nil {
+		t.Fatal("corrupt block was accepted")
+	}
+	if accepted != 5 || corrupt.cs.dbBlockHeight() != 5 {
+		t.Error("AcceptBlockStream did not stop at the corrupt block:", accepted, corrupt.cs.dbBlockHeight())
+	}
+}
+
 // TestInconsistencyCheck puts the consensus set in to an inconsistent state
 // and makes sure that the santiy checks are triggering panics.
 func TestInconsistentCheck(t *testing.T) {
@@ -1037,3 +1427,46 @@ func TestAcceptBlockBroadcasts(t *testing.T) {
 	case <-time.After(10 * time.Millisecond):
 	}
 }
+
+// TestFreeze checks that a frozen consensus set rejects blocks without
+// changing state, and accepts them again once unfrozen.
+func TestFreeze(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestFreeze")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	block, err := cst.miner.FindBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentID := cst.cs.dbCurrentBlockID()
+	cst.cs.Freeze()
+	err = cst.cs.AcceptBlock(block)
+	if err != errFrozen {
+		t.Fatal("expected errFrozen, got", err)
+	}
+	if cst.cs.dbCurrentBlockID() != currentID {
+		t.Fatal("frozen consensus set changed its current block")
+	}
+	err = cst.cs.VerifyInvariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same block should be accepted after unfreezing, as it was not
+	// marked invalid while frozen.
+	cst.cs.Unfreeze()
+	err = cst.cs.AcceptBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cst.cs.dbCurrentBlockID() != block.ID() {
+		t.Error("block was not added to the current path after unfreezing")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -279,7 +280,8 @@ func (cst *consensusSetTester) testValidStorageProofBlocks() {
 	if dsco.UnlockHash != fc.ValidProofOutputs[0].UnlockHash {
 		panic("wrong unlock hash in dsco")
 	}
-	if dsco.Value.Cmp(fc.ValidProofOutputs[0].Value) != 0 {
+	treasuryCut := types.TreasuryCut(fc.ValidProofOutputs[0].Value)
+	if dsco.Value.Cmp(fc.ValidProofOutputs[0].Value.Sub(treasuryCut)) != 0 {
 		panic("wrong sco value in dsco")
 	}
 }
@@ -299,6 +301,353 @@ func TestIntegrationValidStorageProofBlocks(t *testing.T) {
 	cst.testValidStorageProofBlocks()
 }
 
+// TestIntegrationStorageProofOutputMaturity checks that the outputs created by
+// a storage proof cannot be spent until they have matured.
+func TestIntegrationStorageProofOutputMaturity(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestIntegrationStorageProofOutputMaturity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Create a file contract whose valid proof output can be spent by anyone.
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid, fc := cst.addCustomFileContract(file, types.NewCurrency64(400e6), func(fc *types.FileContract) {
+		fc.ValidProofOutputs[0].UnlockHash = types.UnlockConditions{}.UnlockHash()
+	})
+	cst.submitStorageProof(fcid, file)
+
+	// Try to spend the valid proof output before it has matured. The
+	// treasury takes its cut before the output is created.
+	vpo := fc.ValidProofOutputs[0].Value
+	spendTxn := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID: fcid.StorageProofOutputID(types.ProofValid, 0),
+		}},
+		SiacoinOutputs: []types.SiacoinOutput{{
+			Value:      vpo.Sub(types.TreasuryCut(vpo)),
+			UnlockHash: randAddress(),
+		}},
+	}
+	maturityHeight := cst.cs.dbBlockHeight() + types.MaturityDelay
+	for cst.cs.dbBlockHeight() < maturityHeight {
+		_, err = cst.cs.TryTransactionSet([]types.Transaction{spendTxn})
+		if err != errMissingSiacoinOutput {
+			t.Fatal("expecting errMissingSiacoinOutput before maturity, got", err)
+		}
+		_, err = cst.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The output should be spendable once it has matured.
+	_, err = cst.cs.TryTransactionSet([]types.Transaction{spendTxn})
+	if err != nil {
+		t.Error("unable to spend matured storage proof output:", err)
+	}
+}
+
+// TestIntegrationPrecomputedFileContractID checks that the id of a file
+// contract can be computed before the transaction is signed, and that the
+// consensus set uses the same id once the contract is in a block.
+func TestIntegrationPrecomputedFileContractID(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestIntegrationPrecomputedFileContractID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Create an unsigned transaction containing a file contract.
+	payout := types.NewCurrency64(400e6)
+	fc := types.FileContract{
+		WindowStart:        cst.cs.dbBlockHeight() + 2,
+		WindowEnd:          cst.cs.dbBlockHeight() + 3,
+		Payout:             payout,
+		ValidProofOutputs:  []types.SiacoinOutput{{Value: types.PostTax(cst.cs.dbBlockHeight(), payout)}},
+		MissedProofOutputs: []types.SiacoinOutput{{Value: types.PostTax(cst.cs.dbBlockHeight(), payout)}},
+	}
+	txnBuilder := cst.wallet.StartTransaction()
+	err = txnBuilder.FundSiacoins(payout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcIndex := txnBuilder.AddFileContract(fc)
+	unsignedTxn, _ := txnBuilder.View()
+	fcid := unsignedTxn.FileContractID(fcIndex)
+
+	// Sign the transaction and put it in a block.
+	txnSet, err := txnBuilder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cst.tpool.AcceptTransactionSet(txnSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cst.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The consensus set should know the file contract by the precomputed id.
+	_, err = cst.cs.dbGetFileContract(fcid)
+	if err != nil {
+		t.Fatal("file contract not found under the precomputed id:", err)
+	}
+}
+
+// TestIntegrationDuplicateStorageProof checks that a storage proof cannot be
+// resubmitted for a file contract that it has already closed, whether in the
+// same block or in a later block.
+func TestIntegrationDuplicateStorageProof(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestIntegrationDuplicateStorageProof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid, _ := cst.addFileContract(file, types.NewCurrency64(400e6))
+	sp := cst.storageProof(fcid, file)
+
+	// Submit a block containing two transactions with the identical proof.
+	block, target, err := cst.miner.BlockForWork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Transactions = append(block.Transactions,
+		types.Transaction{StorageProofs: []types.StorageProof{sp}},
+		types.Transaction{StorageProofs: []types.StorageProof{sp}, ArbitraryData: [][]byte{{1}}},
+	)
+	solvedBlock, _ := cst.miner.SolveBlock(block, target)
+	err = cst.cs.AcceptBlock(solvedBlock)
+	if err != modules.ErrUnrecognizedFileContractID {
+		t.Error("expecting ErrUnrecognizedFileContractID, got", err)
+	}
+
+	// Accept the proof, and then try to resubmit it in a later block.
+	cst.submitStorageProof(fcid, file)
+	block, target, err = cst.miner.BlockForWork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Transactions = append(block.Transactions, types.Transaction{StorageProofs: []types.StorageProof{sp}})
+	solvedBlock, _ = cst.miner.SolveBlock(block, target)
+	err = cst.cs.AcceptBlock(solvedBlock)
+	if err != modules.ErrUnrecognizedFileContractID {
+		t.Error("expecting ErrUnrecognizedFileContractID, got", err)
+	}
+}
+
+// TestIntegrationStorageProofReceipt checks that a receipt is available for
+// an accepted storage proof, and that the receipt follows the storage proof
+// across reverts and reapplications.
+func TestIntegrationStorageProofReceipt(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestIntegrationStorageProofReceipt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// There should be no receipt for an open file contract.
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid, _ := cst.addFileContract(file, types.NewCurrency64(400e6))
+	_, exists := cst.cs.StorageProofReceipt(fcid)
+	if exists {
+		t.Fatal("receipt exists for an open file contract")
+	}
+
+	// Submit a storage proof and check the receipt.
+	sp := cst.storageProof(fcid, file)
+	cst.submitStorageProof(fcid, file)
+	proofBlock := cst.cs.dbCurrentProcessedBlock()
+	receipt, exists := cst.cs.StorageProofReceipt(fcid)
+	if !exists {
+		t.Fatal("no receipt for an accepted storage proof")
+	}
+	if receipt.ParentID != fcid || receipt.ProofHash != crypto.HashObject(sp) {
+		t.Error("receipt does not match the storage proof")
+	}
+	if receipt.BlockID != proofBlock.Block.ID() || receipt.Height != proofBlock.Height {
+		t.Error("receipt does not point to the block containing the storage proof")
+	}
+
+	// Revert the block containing the storage proof.
+	parent, err := cst.cs.dbGetBlockMap(proofBlock.Block.ParentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cst.cs.dbRevertToNode(parent)
+	_, exists = cst.cs.StorageProofReceipt(fcid)
+	if exists {
+		t.Error("receipt exists after the storage proof was reverted")
+	}
+
+	// Reapply the block containing the storage proof.
+	_, _, err = cst.cs.dbForkBlockchain(proofBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reappliedReceipt, exists := cst.cs.StorageProofReceipt(fcid)
+	if !exists || reappliedReceipt != receipt {
+		t.Error("receipt was not restored after the storage proof was reapplied")
+	}
+}
+
+// TestIntegrationTreasuryStorageProof checks that the treasury, which is
+// enabled in testing, splits the valid proof outputs of a file contract, and
+// that the split is undone when the block containing the storage proof is
+// reverted.
+func TestIntegrationTreasuryStorageProof(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	if types.TreasuryCut(types.SiacoinPrecision).IsZero() {
+		t.Fatal("the treasury should be enabled in testing")
+	}
+	cst, err := createConsensusSetTester("TestIntegrationTreasuryStorageProof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Create a file contract and submit a storage proof for it.
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid, fc := cst.addFileContract(file, types.NewCurrency64(400e6))
+	cst.submitStorageProof(fcid, file)
+
+	// The valid proof output and the treasury output should sum to the
+	// original valid proof output.
+	maturityHeight := cst.cs.dbBlockHeight() + types.MaturityDelay
+	dsco, err := cst.cs.dbGetDSCO(maturityHeight, fcid.StorageProofOutputID(types.ProofValid, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tdsco, err := cst.cs.dbGetDSCO(maturityHeight, fcid.StorageProofTreasuryOutputID(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tdsco.UnlockHash != types.TreasuryUnlockHash {
+		t.Error("treasury output has the wrong unlock hash")
+	}
+	if tdsco.Value.Cmp(types.TreasuryCut(fc.ValidProofOutputs[0].Value)) != 0 {
+		t.Error("treasury output has the wrong value")
+	}
+	if dsco.Value.Add(tdsco.Value).Cmp(fc.ValidProofOutputs[0].Value) != 0 {
+		t.Error("valid proof output and treasury output do not sum to the original output")
+	}
+
+	// Revert the block containing the storage proof. The file contract should
+	// be restored and both outputs should be removed.
+	proofBlock := cst.cs.dbCurrentProcessedBlock()
+	parent, err := cst.cs.dbGetBlockMap(proofBlock.Block.ParentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cst.cs.dbRevertToNode(parent)
+	_, err = cst.cs.dbGetFileContract(fcid)
+	if err != nil {
+		t.Fatal("file contract was not restored after reverting the storage proof:", err)
+	}
+	_, err = cst.cs.dbGetDSCO(maturityHeight, fcid.StorageProofTreasuryOutputID(0))
+	if err != errNilItem {
+		t.Error("treasury output was not removed when the storage proof was reverted")
+	}
+
+	// Reapply the block; the treasury output should reappear.
+	_, _, err = cst.cs.dbForkBlockchain(proofBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cst.cs.dbGetDSCO(maturityHeight, fcid.StorageProofTreasuryOutputID(0))
+	if err != nil {
+		t.Error("treasury output was not recreated when the storage proof was reapplied")
+	}
+}
+
+// TestIntegrationTreasuryZeroCut checks that a valid proof output whose
+// treasury cut rounds down to zero is paid out unchanged, without a treasury
+// output. A disabled treasury takes the same path for every output.
+func TestIntegrationTreasuryZeroCut(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestIntegrationTreasuryZeroCut")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Split the valid proof outputs so that the first is too small for the
+	// treasury to take a cut of.
+	small := types.NewCurrency64(1)
+	if !types.TreasuryCut(small).IsZero() {
+		t.Fatal("treasury takes a cut of a single hasting")
+	}
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid, fc := cst.addCustomFileContract(file, types.NewCurrency64(400e6), func(fc *types.FileContract) {
+		total := fc.ValidProofOutputs[0].Value
+		fc.ValidProofOutputs = []types.SiacoinOutput{
+			{UnlockHash: randAddress(), Value: small},
+			{UnlockHash: randAddress(), Value: total.Sub(small)},
+		}
+	})
+	cst.submitStorageProof(fcid, file)
+
+	maturityHeight := cst.cs.dbBlockHeight() + types.MaturityDelay
+	dsco, err := cst.cs.dbGetDSCO(maturityHeight, fcid.StorageProofOutputID(types.ProofValid, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsco.Value.Cmp(fc.ValidProofOutputs[0].Value) != 0 {
+		t.Error("valid proof output was altered by a zero treasury cut")
+	}
+	_, err = cst.cs.dbGetDSCO(maturityHeight, fcid.StorageProofTreasuryOutputID(0))
+	if err != errNilItem {
+		t.Error("treasury output was created for a zero treasury cut")
+	}
+
+	// The second output is large enough to be split.
+	_, err = cst.cs.dbGetDSCO(maturityHeight, fcid.StorageProofTreasuryOutputID(1))
+	if err != nil {
+		t.Error("treasury output was not created for the second output:", err)
+	}
+}
+
 // testMissedStorageProofBlocks adds a block with a file contract, and then
 // fails to submit a storage proof before expiration.
 func (cst *consensusSetTester) testMissedStorageProofBlocks() {
@@ -566,6 +915,251 @@ func TestIntegrationFileContractRevision(t *testing.T) {
 	cst.testFileContractRevision()
 }
 
+// TestIntegrationFileContractReassignment checks that a file contract can be
+// handed to a new host by a revision, signed by both the host and the renter,
+// that redirects the proof outputs, and that the payout of a subsequent
+// storage proof goes to the new host.
+func TestIntegrationFileContractReassignment(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestIntegrationFileContractReassignment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Create a contract that requires the signatures of both the renter and
+	// the original host to be revised.
+	renterSK, renterPK, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSK, hostPK, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uc := types.UnlockConditions{
+		PublicKeys: []types.SiaPublicKey{
+			{Algorithm: types.SignatureEd25519, Key: renterPK[:]},
+			{Algorithm: types.SignatureEd25519, Key: hostPK[:]},
+		},
+		SignaturesRequired: 2,
+	}
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldHost := randAddress()
+	fcid, fc := cst.addCustomFileContract(file, types.NewCurrency64(400e6), func(fc *types.FileContract) {
+		// Leave room for the revision before the window opens.
+		height := cst.cs.dbBlockHeight()
+		fc.WindowStart = height + 3
+		fc.WindowEnd = height + 5
+		fc.ValidProofOutputs[0].UnlockHash = oldHost
+		fc.MissedProofOutputs[0].UnlockHash = oldHost
+		fc.UnlockHash = uc.UnlockHash()
+	})
+
+	// Reassign the contract by redirecting both proof outputs to the new
+	// host. Everything else about the contract stays the same.
+	newHost := randAddress()
+	fcr := types.FileContractRevision{
+		ParentID:          fcid,
+		UnlockConditions:  uc,
+		NewRevisionNumber: 1,
+
+		NewFileSize:           fc.FileSize,
+		NewFileMerkleRoot:     fc.FileMerkleRoot,
+		NewWindowStart:        fc.WindowStart,
+		NewWindowEnd:          fc.WindowEnd,
+		NewValidProofOutputs:  []types.SiacoinOutput{{Value: fc.ValidProofOutputs[0].Value, UnlockHash: newHost}},
+		NewMissedProofOutputs: []types.SiacoinOutput{{Value: fc.MissedProofOutputs[0].Value, UnlockHash: newHost}},
+		NewUnlockHash:         fc.UnlockHash,
+	}
+	txn := types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{fcr},
+		TransactionSignatures: []types.TransactionSignature{
+			{
+				ParentID:       crypto.Hash(fcid),
+				CoveredFields:  types.CoveredFields{WholeTransaction: true},
+				PublicKeyIndex: 0,
+			},
+			{
+				ParentID:       crypto.Hash(fcid),
+				CoveredFields:  types.CoveredFields{WholeTransaction: true},
+				PublicKeyIndex: 1,
+			},
+		},
+	}
+
+	// A revision signed only by the original host must be rejected.
+	hostOnly := txn
+	hostOnly.TransactionSignatures = []types.TransactionSignature{txn.TransactionSignatures[1]}
+	sig, err := crypto.SignHash(hostOnly.SigHash(0), hostSK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostOnly.TransactionSignatures[0].Signature = sig[:]
+	err = cst.tpool.AcceptTransactionSet([]types.Transaction{hostOnly})
+	if err == nil {
+		t.Fatal("reassignment without the renter's signature was accepted")
+	}
+
+	for i, sk := range []crypto.SecretKey{renterSK, hostSK} {
+		sig, err := crypto.SignHash(txn.SigHash(i), sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txn.TransactionSignatures[i].Signature = sig[:]
+	}
+	err = cst.tpool.AcceptTransactionSet([]types.Transaction{txn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cst.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cst.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Prove the contract and check that the payout goes to the new host.
+	cst.submitStorageProof(fcid, file)
+	maturityHeight := cst.cs.dbBlockHeight() + types.MaturityDelay
+	dsco, err := cst.cs.dbGetDSCO(maturityHeight, fcid.StorageProofOutputID(types.ProofValid, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsco.UnlockHash != newHost {
+		t.Error("storage proof payout was not sent to the new host")
+	}
+	vpo := fc.ValidProofOutputs[0].Value
+	if dsco.Value.Cmp(vpo.Sub(types.TreasuryCut(vpo))) != 0 {
+		t.Error("storage proof payout has the wrong value")
+	}
+}
+
+// TestIntegrationArbitratedFileContractSplit checks that a file contract whose
+// revisions require two of the renter, the host, and an arbiter can be split
+// by the arbiter and one party when the other party disputes it, and that one
+// party cannot revise the contract alone.
+func TestIntegrationArbitratedFileContractSplit(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestIntegrationArbitratedFileContractSplit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Create a contract revisable by any two of the renter, the host, and the
+	// arbiter. All of the funds initially go to the host on a valid proof.
+	var sks []crypto.SecretKey
+	var uc types.UnlockConditions
+	for i := 0; i < 3; i++ {
+		sk, pk, err := crypto.GenerateKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sks = append(sks, sk)
+		uc.PublicKeys = append(uc.PublicKeys, types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: pk[:]})
+	}
+	uc.SignaturesRequired = 2
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renter, host := randAddress(), randAddress()
+	fcid, fc := cst.addCustomFileContract(file, types.NewCurrency64(400e6), func(fc *types.FileContract) {
+		// Leave room for the revision before the window opens.
+		height := cst.cs.dbBlockHeight()
+		fc.WindowStart = height + 3
+		fc.WindowEnd = height + 5
+		fc.ValidProofOutputs[0].UnlockHash = host
+		fc.ValidProofOutputs = append(fc.ValidProofOutputs, types.SiacoinOutput{Value: types.ZeroCurrency, UnlockHash: renter})
+		fc.MissedProofOutputs[0].UnlockHash = renter
+		fc.UnlockHash = uc.UnlockHash()
+	})
+
+	// The arbiter resolves the dispute by splitting the valid proof payout
+	// evenly between the host and the renter.
+	total := fc.ValidProofOutputs[0].Value
+	hostShare := total.Div64(2)
+	renterShare := total.Sub(hostShare)
+	fcr := types.FileContractRevision{
+		ParentID:          fcid,
+		UnlockConditions:  uc,
+		NewRevisionNumber: 1,
+
+		NewFileSize:           fc.FileSize,
+		NewFileMerkleRoot:     fc.FileMerkleRoot,
+		NewWindowStart:        fc.WindowStart,
+		NewWindowEnd:          fc.WindowEnd,
+		NewValidProofOutputs:  []types.SiacoinOutput{{Value: hostShare, UnlockHash: host}, {Value: renterShare, UnlockHash: renter}},
+		NewMissedProofOutputs: fc.MissedProofOutputs,
+		NewUnlockHash:         fc.UnlockHash,
+	}
+	signedRevision := func(keyIndices ...uint64) types.Transaction {
+		txn := types.Transaction{FileContractRevisions: []types.FileContractRevision{fcr}}
+		for _, ki := range keyIndices {
+			txn.TransactionSignatures = append(txn.TransactionSignatures, types.TransactionSignature{
+				ParentID:       crypto.Hash(fcid),
+				CoveredFields:  types.CoveredFields{WholeTransaction: true},
+				PublicKeyIndex: ki,
+			})
+		}
+		for i, ki := range keyIndices {
+			sig, err := crypto.SignHash(txn.SigHash(i), sks[ki])
+			if err != nil {
+				t.Fatal(err)
+			}
+			txn.TransactionSignatures[i].Signature = sig[:]
+		}
+		return txn
+	}
+
+	// Without the arbiter, the renter cannot close the dispute alone.
+	_, err = cst.cs.TryTransactionSet([]types.Transaction{signedRevision(0)})
+	if err != types.ErrMissingSignatures {
+		t.Fatal("expecting ErrMissingSignatures, got", err)
+	}
+
+	// With the arbiter co-signing alongside the renter, the split is
+	// accepted.
+	err = cst.tpool.AcceptTransactionSet([]types.Transaction{signedRevision(0, 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cst.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cst.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A storage proof should now pay out according to the split.
+	cst.submitStorageProof(fcid, file)
+	maturityHeight := cst.cs.dbBlockHeight() + types.MaturityDelay
+	for i, expected := range fcr.NewValidProofOutputs {
+		dsco, err := cst.cs.dbGetDSCO(maturityHeight, fcid.StorageProofOutputID(types.ProofValid, uint64(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected.Value = expected.Value.Sub(types.TreasuryCut(expected.Value))
+		if dsco.UnlockHash != expected.UnlockHash || dsco.Value.Cmp(expected.Value) != 0 {
+			t.Errorf("output %v does not match the split: expected %v, got %v", i, expected, dsco)
+		}
+	}
+}
+
 // testSpendSiafunds spends siafunds on the blockchain.
 func (cst *consensusSetTester) testSpendSiafunds() {
 	// Create a random destination address for the output in the transaction.
@@ -126,6 +126,24 @@ func applyStorageProofs(tx *bolt.Tx, pb *processedBlock, t types.Transaction) {
 
 		// Add all of the outputs in the ValidProofOutputs of the contract.
 		for i, vpo := range fc.ValidProofOutputs {
+			// If the treasury is enabled, split its portion of the output
+			// into a separate delayed output.
+			cut := types.TreasuryCut(vpo.Value)
+			if !cut.IsZero() {
+				vpo.Value = vpo.Value.Sub(cut)
+				tdscod := modules.DelayedSiacoinOutputDiff{
+					Direction: modules.DiffApply,
+					ID:        sp.ParentID.StorageProofTreasuryOutputID(uint64(i)),
+					SiacoinOutput: types.SiacoinOutput{
+						Value:      cut,
+						UnlockHash: types.TreasuryUnlockHash,
+					},
+					MaturityHeight: pb.Height + types.MaturityDelay,
+				}
+				pb.DelayedSiacoinOutputDiffs = append(pb.DelayedSiacoinOutputDiffs, tdscod)
+				commitDelayedSiacoinOutputDiff(tx, tdscod, modules.DiffApply)
+			}
+
 			spoid := sp.ParentID.StorageProofOutputID(types.ProofValid, uint64(i))
 			dscod := modules.DelayedSiacoinOutputDiff{
 				Direction:      modules.DiffApply,
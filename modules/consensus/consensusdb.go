@@ -8,6 +8,7 @@ package consensus
 
 import (
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -49,10 +50,21 @@ var (
 	// siacoin outputs.
 	SiacoinOutputs = []byte("SiacoinOutputs")
 
+	// SiacoinBalances is a database bucket that contains the total value of
+	// the unspent siacoin outputs held by each unlock hash. It is updated
+	// alongside SiacoinOutputs, and unlock hashes with no balance have no
+	// entry.
+	SiacoinBalances = []byte("SiacoinBalances")
+
 	// FileContracts is a database bucket that contains all of the open file
 	// contracts.
 	FileContracts = []byte("FileContracts")
 
+	// StorageProofReceipts is a database bucket that contains a receipt for
+	// every storage proof in the current path, keyed by the id of the file
+	// contract that the proof closed. It is updated alongside BlockPath.
+	StorageProofReceipts = []byte("StorageProofReceipts")
+
 	// SiafundOutputs is a database bucket that contains all of the unspent
 	// siafund outputs.
 	SiafundOutputs = []byte("SiafundOutputs")
@@ -71,7 +83,9 @@ func (cs *ConsensusSet) createConsensusDB(tx *bolt.Tx) error {
 		BlockPath,
 		Consistency,
 		SiacoinOutputs,
+		SiacoinBalances,
 		FileContracts,
+		StorageProofReceipts,
 		SiafundOutputs,
 		SiafundPool,
 	}
@@ -93,9 +107,12 @@ func (cs *ConsensusSet) createConsensusDB(tx *bolt.Tx) error {
 	// Set the siafund pool to 0.
 	setSiafundPool(tx, types.NewCurrency64(0))
 
-	// Update the siafund output diffs map for the genesis block on disk. This
-	// needs to happen between the database being opened/initilized and the
-	// consensus set hash being calculated
+	// Update the siacoin and siafund output diffs map for the genesis block
+	// on disk. This needs to happen between the database being
+	// opened/initilized and the consensus set hash being calculated
+	for _, scod := range cs.blockRoot.SiacoinOutputDiffs {
+		commitSiacoinOutputDiff(tx, scod, modules.DiffApply)
+	}
 	for _, sfod := range cs.blockRoot.SiafundOutputDiffs {
 		commitSiafundOutputDiff(tx, sfod, modules.DiffApply)
 	}
@@ -281,6 +298,7 @@ func addSiacoinOutput(tx *bolt.Tx, id types.SiacoinOutputID, sco types.SiacoinOu
 	if build.DEBUG && err != nil {
 		panic(err)
 	}
+	setSiacoinBalance(tx, sco.UnlockHash, getSiacoinBalance(tx, sco.UnlockHash).Add(sco.Value))
 }
 
 // removeSiacoinOutput removes a siacoin output from the database. An error is
@@ -291,10 +309,130 @@ func removeSiacoinOutput(tx *bolt.Tx, id types.SiacoinOutputID) {
 	if build.DEBUG && scoBucket.Get(id[:]) == nil {
 		panic("nil siacoin output")
 	}
-	err := scoBucket.Delete(id[:])
+	var sco types.SiacoinOutput
+	err := encoding.Unmarshal(scoBucket.Get(id[:]), &sco)
+	if build.DEBUG && err != nil {
+		panic(err)
+	}
+	err = scoBucket.Delete(id[:])
+	if build.DEBUG && err != nil {
+		panic(err)
+	}
+	setSiacoinBalance(tx, sco.UnlockHash, getSiacoinBalance(tx, sco.UnlockHash).Sub(sco.Value))
+}
+
+// getSiacoinBalance returns the total value of the unspent siacoin outputs
+// held by an unlock hash.
+func getSiacoinBalance(tx *bolt.Tx, uh types.UnlockHash) types.Currency {
+	balanceBytes := tx.Bucket(SiacoinBalances).Get(uh[:])
+	if balanceBytes == nil {
+		return types.ZeroCurrency
+	}
+	var balance types.Currency
+	err := encoding.Unmarshal(balanceBytes, &balance)
 	if build.DEBUG && err != nil {
 		panic(err)
 	}
+	return balance
+}
+
+// setSiacoinBalance sets the siacoin balance of an unlock hash. The entry is
+// removed from the database when the balance drops to zero.
+func setSiacoinBalance(tx *bolt.Tx, uh types.UnlockHash, balance types.Currency) {
+	var err error
+	if balance.IsZero() {
+		err = tx.Bucket(SiacoinBalances).Delete(uh[:])
+	} else {
+		err = tx.Bucket(SiacoinBalances).Put(uh[:], encoding.Marshal(balance))
+	}
+	if build.DEBUG && err != nil {
+		panic(err)
+	}
+}
+
+// initSiacoinBalances creates the siacoin balances bucket and fills it by
+// scanning the siacoin output set. It is used to upgrade databases that were
+// created before balances were tracked.
+func initSiacoinBalances(tx *bolt.Tx) error {
+	_, err := tx.CreateBucket(SiacoinBalances)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(SiacoinOutputs).ForEach(func(_, scoBytes []byte) error {
+		var sco types.SiacoinOutput
+		err := encoding.Unmarshal(scoBytes, &sco)
+		if err != nil {
+			return err
+		}
+		setSiacoinBalance(tx, sco.UnlockHash, getSiacoinBalance(tx, sco.UnlockHash).Add(sco.Value))
+		return nil
+	})
+}
+
+// getStorageProofReceipt fetches the receipt for the storage proof that closed
+// a file contract, returning an error if there is none in the current path.
+func getStorageProofReceipt(tx *bolt.Tx, id types.FileContractID) (receipt StorageProofReceipt, err error) {
+	receiptBytes := tx.Bucket(StorageProofReceipts).Get(id[:])
+	if receiptBytes == nil {
+		return StorageProofReceipt{}, errNilItem
+	}
+	err = encoding.Unmarshal(receiptBytes, &receipt)
+	if build.DEBUG && err != nil {
+		panic(err)
+	}
+	return receipt, nil
+}
+
+// updateStorageProofReceipts adds a receipt for every storage proof in a block
+// that is being added to the current path, or removes them if the block is
+// being removed.
+func updateStorageProofReceipts(tx *bolt.Tx, pb *processedBlock, dir modules.DiffDirection) {
+	receiptBucket := tx.Bucket(StorageProofReceipts)
+	bid := pb.Block.ID()
+	for _, txn := range pb.Block.Transactions {
+		for _, sp := range txn.StorageProofs {
+			var err error
+			if dir == modules.DiffApply {
+				// Sanity check - a file contract can only be proven once.
+				if build.DEBUG && receiptBucket.Get(sp.ParentID[:]) != nil {
+					panic("repeat storage proof receipt")
+				}
+				err = receiptBucket.Put(sp.ParentID[:], encoding.Marshal(StorageProofReceipt{
+					ParentID:  sp.ParentID,
+					ProofHash: crypto.HashObject(sp),
+					BlockID:   bid,
+					Height:    pb.Height,
+				}))
+			} else {
+				err = receiptBucket.Delete(sp.ParentID[:])
+			}
+			if build.DEBUG && err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+// initStorageProofReceipts creates the storage proof receipts bucket and fills
+// it by scanning the current path. It is used to upgrade databases that were
+// created before receipts were stored.
+func initStorageProofReceipts(tx *bolt.Tx) error {
+	_, err := tx.CreateBucket(StorageProofReceipts)
+	if err != nil {
+		return err
+	}
+	for height := types.BlockHeight(0); height <= blockHeight(tx); height++ {
+		id, err := getPath(tx, height)
+		if err != nil {
+			return err
+		}
+		pb, err := getBlockMap(tx, id)
+		if err != nil {
+			return err
+		}
+		updateStorageProofReceipts(tx, pb, modules.DiffApply)
+	}
+	return nil
 }
 
 // getFileContract fetches a file contract from the database, returning an
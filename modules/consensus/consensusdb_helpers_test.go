@@ -143,6 +143,32 @@ func (cs *ConsensusSet) dbAddFileContract(id types.FileContractID, fc types.File
 	}
 }
 
+// dbSeedFileContracts inserts the file contracts directly into the consensus
+// set, bypassing transaction validation against the rest of the consensus set
+// so that large fixtures can be created cheaply. The contracts must still pass
+// standalone validation. The contracts are not funded by any siacoin inputs,
+// so blocks must not be mined on top of a seeded consensus set; the seeded
+// state should be exercised by calling the consensus functions directly.
+func (cs *ConsensusSet) dbSeedFileContracts(fcs []types.FileContract) []types.FileContractID {
+	txn := types.Transaction{FileContracts: fcs}
+	err := txn.StandaloneValid(cs.dbBlockHeight())
+	if err != nil {
+		panic(err)
+	}
+	fcids := make([]types.FileContractID, len(fcs))
+	dbErr := cs.db.Update(func(tx *bolt.Tx) error {
+		for i, fc := range fcs {
+			fcids[i] = txn.FileContractID(uint64(i))
+			addFileContract(tx, fcids[i], fc)
+		}
+		return nil
+	})
+	if dbErr != nil {
+		panic(dbErr)
+	}
+	return fcids
+}
+
 // dbRemoveFileContract is a convenience function allowing removeFileContract
 // to be called without a bolt.Tx.
 func (cs *ConsensusSet) dbRemoveFileContract(id types.FileContractID) {
@@ -7,10 +7,14 @@ package consensus
 // commitDiff functions will be sufficient.
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"math"
+	"sort"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
@@ -24,6 +28,54 @@ var (
 	errNilGateway = errors.New("cannot have a nil gateway as input")
 )
 
+// A FileContractFilter restricts the set of file contracts returned by
+// FindFileContracts. Zero-valued fields are ignored, and a file contract must
+// match every field that is set.
+type FileContractFilter struct {
+	// MinPayout and MaxPayout bound the payout of the file contract,
+	// inclusively.
+	MinPayout types.Currency
+	MaxPayout types.Currency
+
+	// DueWithin matches file contracts whose proof window closes within the
+	// given number of blocks of the current height.
+	DueWithin types.BlockHeight
+
+	// MinWindowEnd and MaxWindowEnd bound the height at which the proof
+	// window of the file contract closes, inclusively.
+	MinWindowEnd types.BlockHeight
+	MaxWindowEnd types.BlockHeight
+
+	// UnlockHash matches file contracts that use the unlock hash either as
+	// the revision unlock hash or as the destination of any proof output.
+	UnlockHash types.UnlockHash
+}
+
+// A StorageProofReceipt records where a storage proof for a file contract was
+// accepted into the blockchain.
+type StorageProofReceipt struct {
+	ParentID  types.FileContractID
+	ProofHash crypto.Hash
+	BlockID   types.BlockID
+	Height    types.BlockHeight
+}
+
+// A ContractStatus describes a file contract as seen from one blockchain. A
+// contract that is neither open nor proven either never existed in that
+// blockchain or expired without a storage proof.
+type ContractStatus struct {
+	Open     bool
+	Proven   bool
+	Contract types.FileContract
+}
+
+// A ContractDelta compares the status of a file contract in the current
+// blockchain with its status after a reorg.
+type ContractDelta struct {
+	Before ContractStatus
+	After  ContractStatus
+}
+
 // The ConsensusSet is the object responsible for tracking the current status
 // of the blockchain. Broadly speaking, it is responsible for maintaining
 // consensus.  It accepts blocks and constructs a blockchain, forking when
@@ -71,6 +123,11 @@ type ConsensusSet struct {
 	// whether the consensus set is synced with the network.
 	synced bool
 
+	// frozen is true while the operator has halted the consensus set. No
+	// blocks are accepted while the consensus set is frozen. Freezing is
+	// local to the node and is not persisted.
+	frozen bool
+
 	// Interfaces to abstract the dependencies of the ConsensusSet.
 	marshaler       encoding.GenericMarshaler
 	blockRuleHelper blockRuleHelper
@@ -113,6 +170,17 @@ func New(gateway modules.Gateway, persistDir string) (*ConsensusSet, error) {
 		persistDir: persistDir,
 	}
 
+	// Create the diffs for the genesis siacoin outputs.
+	for i, siacoinOutput := range types.GenesisBlock.Transactions[0].SiacoinOutputs {
+		scid := types.GenesisBlock.Transactions[0].SiacoinOutputID(uint64(i))
+		scod := modules.SiacoinOutputDiff{
+			Direction:     modules.DiffApply,
+			ID:            scid,
+			SiacoinOutput: siacoinOutput,
+		}
+		cs.blockRoot.SiacoinOutputDiffs = append(cs.blockRoot.SiacoinOutputDiffs, scod)
+	}
+
 	// Create the diffs for the genesis siafund outputs.
 	for i, siafundOutput := range types.GenesisBlock.Transactions[0].SiafundOutputs {
 		sfid := types.GenesisBlock.Transactions[0].SiafundOutputID(uint64(i))
@@ -209,6 +277,26 @@ func (cs *ConsensusSet) Close() error {
 	return build.JoinErrors(errs, "; ")
 }
 
+// ContractsEndingBetween returns the ids of the open file contracts whose
+// proof windows close at a height in [low, high], sorted by id. The window end
+// reflects any revisions that have been confirmed.
+func (cs *ConsensusSet) ContractsEndingBetween(low, high types.BlockHeight) (ids []types.FileContractID) {
+	// A zero MaxWindowEnd would leave the range unbounded, but no file
+	// contract can have a window that closes at height 0.
+	if low > high || high == 0 {
+		return nil
+	}
+	fcs := cs.FindFileContracts(FileContractFilter{
+		MinWindowEnd: low,
+		MaxWindowEnd: high,
+	})
+	for id := range fcs {
+		ids = append(ids, id)
+	}
+	sort.Sort(fileContractIDSlice(ids))
+	return ids
+}
+
 // CurrentBlock returns the latest block in the heaviest known blockchain.
 func (cs *ConsensusSet) CurrentBlock() (block types.Block) {
 	_ = cs.db.View(func(tx *bolt.Tx) error {
@@ -219,6 +307,108 @@ func (cs *ConsensusSet) CurrentBlock() (block types.Block) {
 	return block
 }
 
+// FileContractFingerprints returns the fingerprint of every open file
+// contract, keyed by id. Operators of two nodes that disagree about a file
+// contract can compare the maps to find the file contract that diverged.
+func (cs *ConsensusSet) FileContractFingerprints() (fingerprints map[types.FileContractID]crypto.Hash) {
+	fingerprints = make(map[types.FileContractID]crypto.Hash)
+	_ = cs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(FileContracts).ForEach(func(idBytes, fcBytes []byte) error {
+			var id types.FileContractID
+			var fc types.FileContract
+			copy(id[:], idBytes)
+			err := encoding.Unmarshal(fcBytes, &fc)
+			if build.DEBUG && err != nil {
+				panic(err)
+			}
+			fingerprints[id] = fc.Fingerprint()
+			return nil
+		})
+	})
+	return fingerprints
+}
+
+// FindFileContracts returns every open file contract that matches the filter,
+// keyed by id.
+func (cs *ConsensusSet) FindFileContracts(filter FileContractFilter) (fcs map[types.FileContractID]types.FileContract) {
+	fcs = make(map[types.FileContractID]types.FileContract)
+	_ = cs.db.View(func(tx *bolt.Tx) error {
+		// A DueWithin large enough to overflow the deadline matches every
+		// contract.
+		deadline := blockHeight(tx) + filter.DueWithin
+		if deadline < filter.DueWithin {
+			deadline = types.BlockHeight(math.MaxUint64)
+		}
+		return tx.Bucket(FileContracts).ForEach(func(idBytes, fcBytes []byte) error {
+			var fc types.FileContract
+			err := encoding.Unmarshal(fcBytes, &fc)
+			if build.DEBUG && err != nil {
+				panic(err)
+			}
+			if filter.DueWithin != 0 && fc.WindowEnd > deadline {
+				return nil
+			}
+			if fc.WindowEnd < filter.MinWindowEnd {
+				return nil
+			}
+			if filter.MaxWindowEnd != 0 && fc.WindowEnd > filter.MaxWindowEnd {
+				return nil
+			}
+			if !filter.MinPayout.IsZero() && fc.Payout.Cmp(filter.MinPayout) < 0 {
+				return nil
+			}
+			if !filter.MaxPayout.IsZero() && fc.Payout.Cmp(filter.MaxPayout) > 0 {
+				return nil
+			}
+			if filter.UnlockHash != (types.UnlockHash{}) && !fileContractUsesUnlockHash(fc, filter.UnlockHash) {
+				return nil
+			}
+
+			var id types.FileContractID
+			copy(id[:], idBytes)
+			fcs[id] = fc
+			return nil
+		})
+	})
+	return fcs
+}
+
+// fileContractUsesUnlockHash returns true if the unlock hash is the revision
+// unlock hash of the file contract or receives any of its proof outputs.
+func fileContractUsesUnlockHash(fc types.FileContract, uh types.UnlockHash) bool {
+	if fc.UnlockHash == uh {
+		return true
+	}
+	for _, sco := range fc.ValidProofOutputs {
+		if sco.UnlockHash == uh {
+			return true
+		}
+	}
+	for _, sco := range fc.MissedProofOutputs {
+		if sco.UnlockHash == uh {
+			return true
+		}
+	}
+	return false
+}
+
+// fileContractIDSlice implements sort.Interface, ordering file contract ids
+// in byte-order.
+type fileContractIDSlice []types.FileContractID
+
+func (ids fileContractIDSlice) Len() int           { return len(ids) }
+func (ids fileContractIDSlice) Less(i, j int) bool { return bytes.Compare(ids[i][:], ids[j][:]) < 0 }
+func (ids fileContractIDSlice) Swap(i, j int)      { ids[i], ids[j] = ids[j], ids[i] }
+
+// Freeze halts the consensus set. While frozen, all blocks are rejected, so
+// the current path and the state built from it stop changing. Freeze is
+// intended for responding to a discovered consensus bug.
+func (cs *ConsensusSet) Freeze() {
+	cs.mu.Lock()
+	cs.frozen = true
+	cs.mu.Unlock()
+}
+
 // Height returns the height of the consensus set.
 func (cs *ConsensusSet) Height() (height types.BlockHeight) {
 	_ = cs.db.View(func(tx *bolt.Tx) error {
@@ -228,6 +418,32 @@ func (cs *ConsensusSet) Height() (height types.BlockHeight) {
 	return height
 }
 
+// IdleContracts returns the ids of the open file contracts whose proof window
+// opened at or before 'since' and which have not yet received a storage proof.
+// A proven contract is removed from the consensus set, so any open contract
+// past the start of its window is still waiting on its host.
+func (cs *ConsensusSet) IdleContracts(since types.BlockHeight) (ids []types.FileContractID) {
+	_ = cs.db.View(func(tx *bolt.Tx) error {
+		if since > blockHeight(tx) {
+			since = blockHeight(tx)
+		}
+		return tx.Bucket(FileContracts).ForEach(func(idBytes, fcBytes []byte) error {
+			var fc types.FileContract
+			err := encoding.Unmarshal(fcBytes, &fc)
+			if build.DEBUG && err != nil {
+				panic(err)
+			}
+			if fc.WindowStart <= since {
+				var id types.FileContractID
+				copy(id[:], idBytes)
+				ids = append(ids, id)
+			}
+			return nil
+		})
+	})
+	return ids
+}
+
 // InCurrentPath returns true if the block presented is in the current path,
 // false otherwise.
 func (cs *ConsensusSet) InCurrentPath(id types.BlockID) (inPath bool) {
@@ -264,12 +480,121 @@ func (cs *ConsensusSet) MinimumValidChildTimestamp(id types.BlockID) (timestamp
 	return timestamp, exists
 }
 
+// ProofCalendar returns the ids of the open file contracts whose proof windows
+// close within the given number of blocks, keyed by the height at which each
+// window closes. A storage proof for a contract must be in a block below that
+// height. Heights with no closing windows are omitted.
+func (cs *ConsensusSet) ProofCalendar(within types.BlockHeight) (calendar map[types.BlockHeight][]types.FileContractID) {
+	calendar = make(map[types.BlockHeight][]types.FileContractID)
+	_ = cs.db.View(func(tx *bolt.Tx) error {
+		// Only the expiration buckets that exist are visited, so the work
+		// depends on the open file contracts rather than on 'within'.
+		height := blockHeight(tx)
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if !bytes.HasPrefix(name, prefixFCEX) {
+				return nil
+			}
+			var h types.BlockHeight
+			err := encoding.Unmarshal(name[len(prefixFCEX):], &h)
+			if build.DEBUG && err != nil {
+				panic(err)
+			}
+			// The comparison is written to avoid overflowing height+within.
+			if h <= height || h-height > within {
+				return nil
+			}
+			return b.ForEach(func(keyBytes, _ []byte) error {
+				var id types.FileContractID
+				copy(id[:], keyBytes)
+				calendar[h] = append(calendar[h], id)
+				return nil
+			})
+		})
+	})
+	return calendar
+}
+
+// SiacoinBalance returns the total value of the unspent siacoin outputs held
+// by an unlock hash. Delayed siacoin outputs are not counted until they
+// mature. Balances are maintained as blocks are applied and reverted, so the
+// call does not scan the siacoin output set.
+func (cs *ConsensusSet) SiacoinBalance(uh types.UnlockHash) (balance types.Currency) {
+	_ = cs.db.View(func(tx *bolt.Tx) error {
+		balance = getSiacoinBalance(tx, uh)
+		return nil
+	})
+	return balance
+}
+
+// StorageProofReceipt returns a receipt for the storage proof that closed the
+// file contract, if the proof is in the current blockchain. Receipts are
+// stored as blocks are added to the current path, and removed if the block
+// containing the proof is reverted.
+func (cs *ConsensusSet) StorageProofReceipt(fcid types.FileContractID) (receipt StorageProofReceipt, exists bool) {
+	_ = cs.db.View(func(tx *bolt.Tx) error {
+		var err error
+		receipt, err = getStorageProofReceipt(tx, fcid)
+		exists = err == nil
+		return nil
+	})
+	return receipt, exists
+}
+
+// contractStatus returns the status of a file contract in the current path.
+func contractStatus(tx *bolt.Tx, fcid types.FileContractID) (status ContractStatus) {
+	fc, err := getFileContract(tx, fcid)
+	if err == nil {
+		status.Open = true
+		status.Contract = fc
+		return status
+	}
+	_, err = getStorageProofReceipt(tx, fcid)
+	status.Proven = err == nil
+	return status
+}
+
 // StorageProofSegment returns the segment to be used in the storage proof for
-// a given file contract.
+// a given file contract. ErrTerminatedFileContract is returned for a file
+// contract that was closed within the last few blocks.
 func (cs *ConsensusSet) StorageProofSegment(fcid types.FileContractID) (index uint64, err error) {
 	_ = cs.db.View(func(tx *bolt.Tx) error {
 		index, err = storageProofSegment(tx, fcid)
+		if err == modules.ErrUnrecognizedFileContractID && fileContractTerminated(tx, fcid) {
+			err = modules.ErrTerminatedFileContract
+		}
 		return nil
 	})
 	return index, err
 }
+
+// StorageProofTrigger returns the id of the block that seeds the choice of
+// storage proof segment for a given file contract. ErrTerminatedFileContract is
+// returned for a file contract that was closed within the last few blocks.
+func (cs *ConsensusSet) StorageProofTrigger(fcid types.FileContractID) (id types.BlockID, err error) {
+	_ = cs.db.View(func(tx *bolt.Tx) error {
+		id, _, err = storageProofTrigger(tx, fcid)
+		if err == modules.ErrUnrecognizedFileContractID && fileContractTerminated(tx, fcid) {
+			err = modules.ErrTerminatedFileContract
+		}
+		return nil
+	})
+	return id, err
+}
+
+// Unfreeze resumes accepting blocks after a call to Freeze.
+func (cs *ConsensusSet) Unfreeze() {
+	cs.mu.Lock()
+	cs.frozen = false
+	cs.mu.Unlock()
+}
+
+// VerifyInvariants scans the entire consensus set and checks that it satisfies
+// the invariants that should hold at every block height, such as the
+// conservation of siacoins and siafunds and the consistency of every open file
+// contract. The first violation found is returned. The scan is expensive and
+// is intended to be run on demand while debugging.
+func (cs *ConsensusSet) VerifyInvariants() error {
+	return cs.db.View(func(tx *bolt.Tx) error {
+		return checkInvariants(tx)
+	})
+}
@@ -2,7 +2,9 @@ package consensus
 
 import (
 	"crypto/rand"
+	"math"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/NebulousLabs/Sia/build"
@@ -90,6 +92,102 @@ func (cst *consensusSetTester) mineSiacoins() {
 	}
 }
 
+// addFileContract funds a file contract for 'file' and mines it into the
+// blockchain. The storage proof window of the contract opens in the block
+// following the contract. The id of the contract is returned alongside the
+// contract itself.
+func (cst *consensusSetTester) addFileContract(file []byte, payout types.Currency) (types.FileContractID, types.FileContract) {
+	return cst.addCustomFileContract(file, payout, func(*types.FileContract) {})
+}
+
+// addCustomFileContract is like addFileContract, but calls 'customize' on the
+// file contract before it is funded, allowing tests to change its windows,
+// outputs, or unlock hash. 'customize' is called after the block height has
+// been stepped up, so it can use the current height.
+func (cst *consensusSetTester) addCustomFileContract(file []byte, payout types.Currency, customize func(*types.FileContract)) (types.FileContractID, types.FileContract) {
+	// COMPATv0.4.0 - Step the block height up past the hardfork amount. This
+	// code stops nondeterministic failures when producing storage proofs that
+	// is related to buggy old code.
+	for cst.cs.dbBlockHeight() <= 10 {
+		_, err := cst.miner.AddBlock()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	height := cst.cs.dbBlockHeight()
+	fc := types.FileContract{
+		FileSize:       uint64(len(file)),
+		FileMerkleRoot: crypto.MerkleRoot(file),
+		WindowStart:    height + 2,
+		WindowEnd:      height + 3,
+		Payout:         payout,
+		ValidProofOutputs: []types.SiacoinOutput{{
+			UnlockHash: randAddress(),
+			Value:      types.PostTax(height, payout),
+		}},
+		MissedProofOutputs: []types.SiacoinOutput{{
+			UnlockHash: types.UnlockHash{},
+			Value:      types.PostTax(height, payout),
+		}},
+	}
+	customize(&fc)
+	txnBuilder := cst.wallet.StartTransaction()
+	err := txnBuilder.FundSiacoins(payout)
+	if err != nil {
+		panic(err)
+	}
+	fcIndex := txnBuilder.AddFileContract(fc)
+	txnSet, err := txnBuilder.Sign(true)
+	if err != nil {
+		panic(err)
+	}
+	err = cst.tpool.AcceptTransactionSet(txnSet)
+	if err != nil {
+		panic(err)
+	}
+	_, err = cst.miner.AddBlock()
+	if err != nil {
+		panic(err)
+	}
+	return txnSet[len(txnSet)-1].FileContractID(fcIndex), fc
+}
+
+// storageProof creates a valid storage proof for the file contract 'fcid',
+// which must be a contract for 'file' whose proof window is open.
+func (cst *consensusSetTester) storageProof(fcid types.FileContractID, file []byte) types.StorageProof {
+	segmentIndex, err := cst.cs.StorageProofSegment(fcid)
+	if err != nil {
+		panic(err)
+	}
+	segment, hashSet := crypto.MerkleProof(file, segmentIndex)
+	sp := types.StorageProof{
+		ParentID: fcid,
+		HashSet:  hashSet,
+	}
+	copy(sp.Segment[:], segment)
+	return sp
+}
+
+// submitStorageProof creates a storage proof for the file contract 'fcid' and
+// mines it into the blockchain.
+func (cst *consensusSetTester) submitStorageProof(fcid types.FileContractID, file []byte) {
+	txnBuilder := cst.wallet.StartTransaction()
+	txnBuilder.AddStorageProof(cst.storageProof(fcid, file))
+	txnSet, err := txnBuilder.Sign(true)
+	if err != nil {
+		panic(err)
+	}
+	err = cst.tpool.AcceptTransactionSet(txnSet)
+	if err != nil {
+		panic(err)
+	}
+	_, err = cst.miner.AddBlock()
+	if err != nil {
+		panic(err)
+	}
+}
+
 // blankConsensusSetTester creates a consensusSetTester that has only the
 // genesis block.
 func blankConsensusSetTester(name string) (*consensusSetTester, error) {
@@ -206,3 +304,436 @@ func TestDatabaseClosing(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+// TestFindFileContracts probes the FindFileContracts method of the consensus
+// set.
+func TestFindFileContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestFindFileContracts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Add three file contracts with distinct payouts, deadlines and
+	// addresses.
+	height := cst.cs.dbBlockHeight()
+	uh1, uh2, uh3 := randAddress(), randAddress(), randAddress()
+	id1, id2, id3 := types.FileContractID{1}, types.FileContractID{2}, types.FileContractID{3}
+	cst.cs.dbAddFileContract(id1, types.FileContract{
+		Payout:      types.NewCurrency64(100),
+		WindowStart: height + 1,
+		WindowEnd:   height + 5,
+		UnlockHash:  uh1,
+	})
+	cst.cs.dbAddFileContract(id2, types.FileContract{
+		Payout:            types.NewCurrency64(200),
+		WindowStart:       height + 40,
+		WindowEnd:         height + 50,
+		ValidProofOutputs: []types.SiacoinOutput{{UnlockHash: uh2}},
+	})
+	cst.cs.dbAddFileContract(id3, types.FileContract{
+		Payout:             types.NewCurrency64(300),
+		WindowStart:        height + 400,
+		WindowEnd:          height + 500,
+		MissedProofOutputs: []types.SiacoinOutput{{UnlockHash: uh3}},
+	})
+
+	tests := []struct {
+		name     string
+		filter   FileContractFilter
+		expected []types.FileContractID
+	}{
+		{"Empty", FileContractFilter{}, []types.FileContractID{id1, id2, id3}},
+		{"MinPayout", FileContractFilter{MinPayout: types.NewCurrency64(200)}, []types.FileContractID{id2, id3}},
+		{"MaxPayout", FileContractFilter{MaxPayout: types.NewCurrency64(200)}, []types.FileContractID{id1, id2}},
+		{"PayoutRange", FileContractFilter{MinPayout: types.NewCurrency64(150), MaxPayout: types.NewCurrency64(250)}, []types.FileContractID{id2}},
+		{"DueWithin", FileContractFilter{DueWithin: 50}, []types.FileContractID{id1, id2}},
+		{"DueWithinExclusive", FileContractFilter{DueWithin: 4}, nil},
+		{"DueWithinOverflow", FileContractFilter{DueWithin: types.BlockHeight(math.MaxUint64)}, []types.FileContractID{id1, id2, id3}},
+		{"MinWindowEnd", FileContractFilter{MinWindowEnd: height + 50}, []types.FileContractID{id2, id3}},
+		{"MaxWindowEnd", FileContractFilter{MaxWindowEnd: height + 50}, []types.FileContractID{id1, id2}},
+		{"WindowEndRange", FileContractFilter{MinWindowEnd: height + 6, MaxWindowEnd: height + 499}, []types.FileContractID{id2}},
+		{"RevisionUnlockHash", FileContractFilter{UnlockHash: uh1}, []types.FileContractID{id1}},
+		{"ValidOutputUnlockHash", FileContractFilter{UnlockHash: uh2}, []types.FileContractID{id2}},
+		{"MissedOutputUnlockHash", FileContractFilter{UnlockHash: uh3}, []types.FileContractID{id3}},
+		{"UnknownUnlockHash", FileContractFilter{UnlockHash: randAddress()}, nil},
+		{"DueWithinAndMinPayout", FileContractFilter{DueWithin: 500, MinPayout: types.NewCurrency64(300)}, []types.FileContractID{id3}},
+		{"Contradiction", FileContractFilter{DueWithin: 5, UnlockHash: uh3}, nil},
+	}
+	for _, test := range tests {
+		fcs := cst.cs.FindFileContracts(test.filter)
+		if len(fcs) != len(test.expected) {
+			t.Errorf("%v: expected %v file contracts, got %v", test.name, len(test.expected), len(fcs))
+			continue
+		}
+		for _, id := range test.expected {
+			if _, exists := fcs[id]; !exists {
+				t.Errorf("%v: file contract %v is missing", test.name, id)
+			}
+		}
+	}
+
+	// The returned file contracts should be copies.
+	fcs := cst.cs.FindFileContracts(FileContractFilter{UnlockHash: uh2})
+	fcs[id2].ValidProofOutputs[0].UnlockHash = types.UnlockHash{}
+	fc, err := cst.cs.dbGetFileContract(id2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fc.ValidProofOutputs[0].UnlockHash != uh2 {
+		t.Error("FindFileContracts returned a reference to the stored file contract")
+	}
+}
+
+// TestProofCalendar checks that the proof calendar groups file contracts by
+// the height at which their proof windows close.
+func TestProofCalendar(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestProofCalendar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	height := cst.cs.dbBlockHeight()
+	windowEnds := []types.BlockHeight{height + 1, height + 5, height + 5, height + 20}
+	for i, windowEnd := range windowEnds {
+		cst.cs.dbAddFileContract(types.FileContractID{byte(i + 1)}, types.FileContract{
+			Payout:      types.NewCurrency64(1),
+			WindowStart: height + 1,
+			WindowEnd:   windowEnd,
+		})
+	}
+
+	calendar := cst.cs.ProofCalendar(10)
+	if len(calendar) != 2 {
+		t.Fatal("expected 2 heights in the calendar, got", len(calendar))
+	}
+	if len(calendar[height+1]) != 1 || calendar[height+1][0] != (types.FileContractID{1}) {
+		t.Error("wrong file contracts closing at", height+1, calendar[height+1])
+	}
+	if len(calendar[height+5]) != 2 {
+		t.Error("wrong file contracts closing at", height+5, calendar[height+5])
+	}
+	for _, id := range calendar[height+5] {
+		if id != (types.FileContractID{2}) && id != (types.FileContractID{3}) {
+			t.Error("unexpected file contract closing at", height+5, id)
+		}
+	}
+
+	// The window is inclusive of its last height.
+	if len(cst.cs.ProofCalendar(20)[height+20]) != 1 {
+		t.Error("file contract closing at the end of the range was not included")
+	}
+	if len(cst.cs.ProofCalendar(0)) != 0 {
+		t.Error("empty range produced a non-empty calendar")
+	}
+
+	// A range that would overflow the block height includes every file
+	// contract.
+	calendar = cst.cs.ProofCalendar(types.BlockHeight(math.MaxUint64))
+	if len(calendar) != 3 {
+		t.Error("expected 3 heights in an unbounded calendar, got", len(calendar))
+	}
+}
+
+// TestFileContractFingerprints checks that changing a single field of a file
+// contract changes the fingerprint of that file contract and no other.
+func TestFileContractFingerprints(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestFileContractFingerprints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	height := cst.cs.dbBlockHeight()
+	id1, id2 := types.FileContractID{1}, types.FileContractID{2}
+	fc := types.FileContract{
+		Payout:      types.NewCurrency64(100),
+		WindowStart: height + 1,
+		WindowEnd:   height + 5,
+	}
+	cst.cs.dbAddFileContract(id1, fc)
+	cst.cs.dbAddFileContract(id2, fc)
+	before := cst.cs.FileContractFingerprints()
+	if len(before) != 2 {
+		t.Fatal("expected 2 fingerprints, got", len(before))
+	}
+	if before[id1] != fc.Fingerprint() {
+		t.Error("fingerprint does not match the stored file contract")
+	}
+
+	// Change the revision number of the second file contract.
+	cst.cs.dbRemoveFileContract(id2)
+	fc.RevisionNumber++
+	cst.cs.dbAddFileContract(id2, fc)
+	after := cst.cs.FileContractFingerprints()
+	if after[id1] != before[id1] {
+		t.Error("fingerprint of an unchanged file contract changed")
+	}
+	if after[id2] == before[id2] {
+		t.Error("fingerprint did not change after the revision number changed")
+	}
+}
+
+// TestContractsEndingBetween checks that ContractsEndingBetween selects
+// contracts by the end of their proof window, inclusively, and follows
+// revisions of the window.
+func TestContractsEndingBetween(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestContractsEndingBetween")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	height := cst.cs.dbBlockHeight()
+	ends := []types.BlockHeight{height + 5, height + 10, height + 15}
+	for i, end := range ends {
+		cst.cs.dbAddFileContract(types.FileContractID{byte(i + 1)}, types.FileContract{
+			Payout:      types.NewCurrency64(1),
+			WindowStart: height + 1,
+			WindowEnd:   end,
+		})
+	}
+
+	tests := []struct {
+		low, high types.BlockHeight
+		expected  []types.FileContractID
+	}{
+		{height, height + 4, nil},
+		{height + 5, height + 5, []types.FileContractID{{1}}},
+		{height + 5, height + 10, []types.FileContractID{{1}, {2}}},
+		{height + 6, height + 20, []types.FileContractID{{2}, {3}}},
+		{height + 11, height + 14, nil},
+		{height + 10, height + 5, nil},
+	}
+	for _, test := range tests {
+		ids := cst.cs.ContractsEndingBetween(test.low, test.high)
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("[%v, %v]: expected %v, got %v", test.low, test.high, test.expected, ids)
+		}
+	}
+
+	// Move the end of the first contract past the end of the third.
+	fc, err := cst.cs.dbGetFileContract(types.FileContractID{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cst.cs.dbRemoveFileContract(types.FileContractID{1})
+	fc.WindowEnd = height + 20
+	cst.cs.dbAddFileContract(types.FileContractID{1}, fc)
+	ids := cst.cs.ContractsEndingBetween(height+15, height+20)
+	if !reflect.DeepEqual(ids, []types.FileContractID{{1}, {3}}) {
+		t.Error("revised window end was not used:", ids)
+	}
+}
+
+// TestIdleContracts checks that IdleContracts reports the contracts whose
+// windows have opened without a storage proof, and no others.
+func TestIdleContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestIdleContracts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Create two contracts. The window of the first opens in the block that
+	// confirms the second.
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idleID, idleFC := cst.addFileContract(file, types.NewCurrency64(400e6))
+	if ids := cst.cs.IdleContracts(cst.cs.dbBlockHeight()); len(ids) != 0 {
+		t.Fatal("contract was reported idle before its window opened:", ids)
+	}
+	provenID, provenFC := cst.addFileContract(file, types.NewCurrency64(400e6))
+	if cst.cs.dbBlockHeight() != idleFC.WindowStart || provenFC.WindowStart <= idleFC.WindowStart {
+		t.Fatal("test expects only the first contract's window to be open")
+	}
+
+	// Only the contract with an open window should be idle, and only when
+	// asking about heights at or after the window start.
+	ids := cst.cs.IdleContracts(cst.cs.dbBlockHeight())
+	if len(ids) != 1 || ids[0] != idleID {
+		t.Fatal("expected only the first contract to be idle, got", ids)
+	}
+	if ids := cst.cs.IdleContracts(idleFC.WindowStart - 1); len(ids) != 0 {
+		t.Error("contract reported idle before its window opened:", ids)
+	}
+
+	// Once the second contract is proven it is no longer open, and the first
+	// contract expires without a proof in the same block.
+	cst.submitStorageProof(provenID, file)
+	if ids := cst.cs.IdleContracts(cst.cs.dbBlockHeight()); len(ids) != 0 {
+		t.Error("closed contracts were reported idle:", ids)
+	}
+}
+
+// TestSiacoinBalanceReorg checks that siacoin balances are kept in sync with
+// the siacoin output set when the block that changed them is reverted and
+// reapplied.
+func TestSiacoinBalanceReorg(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestSiacoinBalanceReorg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Send siacoins to a fresh address.
+	uh := randAddress()
+	value := types.NewCurrency64(5e3)
+	txnBuilder := cst.wallet.StartTransaction()
+	err = txnBuilder.FundSiacoins(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txnBuilder.AddSiacoinOutput(types.SiacoinOutput{UnlockHash: uh, Value: value})
+	txnSet, err := txnBuilder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cst.tpool.AcceptTransactionSet(txnSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cst.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cst.cs.SiacoinBalance(uh).Cmp(value) != 0 {
+		t.Fatal("balance was not credited:", cst.cs.SiacoinBalance(uh))
+	}
+	err = cst.cs.VerifyInvariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Revert the block and check that the balance is removed.
+	pb := cst.cs.dbCurrentProcessedBlock()
+	parent, err := cst.cs.dbGetBlockMap(pb.Block.ParentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cst.cs.dbRevertToNode(parent)
+	if !cst.cs.SiacoinBalance(uh).IsZero() {
+		t.Error("balance survived the revert:", cst.cs.SiacoinBalance(uh))
+	}
+	err = cst.cs.VerifyInvariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reapply the block and check that the balance is restored.
+	_, _, err = cst.cs.dbForkBlockchain(pb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cst.cs.SiacoinBalance(uh).Cmp(value) != 0 {
+		t.Error("balance was not restored:", cst.cs.SiacoinBalance(uh))
+	}
+	err = cst.cs.VerifyInvariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestIntegrationGenesisSiacoinAllocation checks that the genesis siacoin
+// allocation is added to the consensus set and can be spent. The built-in
+// networks have no allocation, so the test installs one for the duration of
+// the test. The test is not parallel because it changes the genesis block.
+func TestIntegrationGenesisSiacoinAllocation(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	// Give the anyone-can-spend unlock hash a genesis allocation, and restore
+	// the genesis block once the tester has been closed.
+	oldAllocation, oldBlock, oldID := types.GenesisSiacoinAllocation, types.GenesisBlock, types.GenesisID
+	defer func() {
+		types.GenesisSiacoinAllocation, types.GenesisBlock, types.GenesisID = oldAllocation, oldBlock, oldID
+	}()
+	allocation := types.SiacoinOutput{
+		Value:      types.NewCurrency64(1000).Mul(types.SiacoinPrecision),
+		UnlockHash: types.UnlockConditions{}.UnlockHash(),
+	}
+	types.GenesisSiacoinAllocation = []types.SiacoinOutput{allocation}
+	types.GenesisBlock.Transactions = []types.Transaction{{
+		SiacoinOutputs: types.GenesisSiacoinAllocation,
+		SiafundOutputs: types.GenesisSiafundAllocation,
+	}}
+	types.GenesisID = types.GenesisBlock.ID()
+
+	cst, err := createConsensusSetTester("TestIntegrationGenesisSiacoinAllocation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	scoid := types.GenesisBlock.Transactions[0].SiacoinOutputID(0)
+	sco, err := cst.cs.dbGetSiacoinOutput(scoid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sco.Value.Cmp(allocation.Value) != 0 || sco.UnlockHash != allocation.UnlockHash {
+		t.Fatal("genesis siacoin output does not match the allocation")
+	}
+	if cst.cs.SiacoinBalance(allocation.UnlockHash).Cmp(allocation.Value) != 0 {
+		t.Error("genesis allocation is missing from the siacoin balances")
+	}
+	err = cst.cs.VerifyInvariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Spend the allocation to a fresh address.
+	uh := randAddress()
+	txn := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID:         scoid,
+			UnlockConditions: types.UnlockConditions{},
+		}},
+		SiacoinOutputs: []types.SiacoinOutput{{
+			Value:      allocation.Value,
+			UnlockHash: uh,
+		}},
+	}
+	err = cst.tpool.AcceptTransactionSet([]types.Transaction{txn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cst.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cst.cs.dbGetSiacoinOutput(scoid)
+	if err != errNilItem {
+		t.Error("genesis siacoin output was not spent:", err)
+	}
+	if cst.cs.SiacoinBalance(uh).Cmp(allocation.Value) != 0 {
+		t.Error("spent allocation did not arrive at the new address")
+	}
+}
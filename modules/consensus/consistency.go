@@ -77,7 +77,7 @@ func consensusChecksum(tx *bolt.Tx) crypto.Hash {
 
 // checkSiacoinCount checks that the number of siacoins countable within the
 // consensus set equal the expected number of siacoins for the block height.
-func checkSiacoinCount(tx *bolt.Tx) {
+func checkSiacoinCount(tx *bolt.Tx) error {
 	// Iterate through all the buckets looking for the delayed siacoin output
 	// buckets, and check that they are for the correct heights.
 	var dscoSiacoins types.Currency
@@ -88,22 +88,18 @@ func checkSiacoinCount(tx *bolt.Tx) {
 		}
 
 		// Sum up the delayed outputs in this bucket.
-		err := b.ForEach(func(_, delayedOutput []byte) error {
+		return b.ForEach(func(_, delayedOutput []byte) error {
 			var sco types.SiacoinOutput
 			err := encoding.Unmarshal(delayedOutput, &sco)
 			if err != nil {
-				manageErr(tx, err)
+				return err
 			}
 			dscoSiacoins = dscoSiacoins.Add(sco.Value)
 			return nil
 		})
-		if err != nil {
-			return err
-		}
-		return nil
 	})
 	if err != nil {
-		manageErr(tx, err)
+		return err
 	}
 
 	// Add all of the siacoin outputs.
@@ -112,13 +108,13 @@ func checkSiacoinCount(tx *bolt.Tx) {
 		var sco types.SiacoinOutput
 		err := encoding.Unmarshal(scoBytes, &sco)
 		if err != nil {
-			manageErr(tx, err)
+			return err
 		}
 		scoSiacoins = scoSiacoins.Add(sco.Value)
 		return nil
 	})
 	if err != nil {
-		manageErr(tx, err)
+		return err
 	}
 
 	// Add all of the payouts from file contracts.
@@ -127,7 +123,7 @@ func checkSiacoinCount(tx *bolt.Tx) {
 		var fc types.FileContract
 		err := encoding.Unmarshal(fcBytes, &fc)
 		if err != nil {
-			manageErr(tx, err)
+			return err
 		}
 		var fcCoins types.Currency
 		for _, output := range fc.ValidProofOutputs {
@@ -137,7 +133,7 @@ func checkSiacoinCount(tx *bolt.Tx) {
 		return nil
 	})
 	if err != nil {
-		manageErr(tx, err)
+		return err
 	}
 
 	// Add all of the siafund claims.
@@ -146,7 +142,7 @@ func checkSiacoinCount(tx *bolt.Tx) {
 		var sfo types.SiafundOutput
 		err := encoding.Unmarshal(sfoBytes, &sfo)
 		if err != nil {
-			manageErr(tx, err)
+			return err
 		}
 
 		coinsPerFund := getSiafundPool(tx).Sub(sfo.ClaimStart)
@@ -155,7 +151,7 @@ func checkSiacoinCount(tx *bolt.Tx) {
 		return nil
 	})
 	if err != nil {
-		manageErr(tx, err)
+		return err
 	}
 
 	expectedSiacoins := types.CalculateNumSiacoins(blockHeight(tx))
@@ -167,34 +163,79 @@ func checkSiacoinCount(tx *bolt.Tx) {
 		} else {
 			diagnostics += fmt.Sprintf("total: %v\nexpected: %v\n expected is bigger: %v", totalSiacoins, expectedSiacoins, totalSiacoins.Sub(expectedSiacoins))
 		}
-		manageErr(tx, errors.New(diagnostics))
+		return errors.New(diagnostics)
 	}
+	return nil
+}
+
+// checkSiacoinBalances checks that the siacoin balances bucket matches the
+// balances computed by scanning the full siacoin output set.
+func checkSiacoinBalances(tx *bolt.Tx) error {
+	balances := make(map[types.UnlockHash]types.Currency)
+	err := tx.Bucket(SiacoinOutputs).ForEach(func(_, scoBytes []byte) error {
+		var sco types.SiacoinOutput
+		err := encoding.Unmarshal(scoBytes, &sco)
+		if err != nil {
+			return err
+		}
+		balances[sco.UnlockHash] = balances[sco.UnlockHash].Add(sco.Value)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for uh, balance := range balances {
+		if balance.Cmp(getSiacoinBalance(tx, uh)) != 0 {
+			return fmt.Errorf("siacoin balance of %v does not match the siacoin output set", uh)
+		}
+	}
+	// Zero balances are not stored, so any additional entry in the bucket has
+	// no outputs backing it.
+	var numBalances int
+	err = tx.Bucket(SiacoinBalances).ForEach(func(_, _ []byte) error {
+		numBalances++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var numNonZero int
+	for _, balance := range balances {
+		if !balance.IsZero() {
+			numNonZero++
+		}
+	}
+	if numBalances != numNonZero {
+		return errors.New("siacoin balances contain unlock hashes without siacoin outputs")
+	}
+	return nil
 }
 
 // checkSiafundCount checks that the number of siafunds countable within the
 // consensus set equal the expected number of siafunds for the block height.
-func checkSiafundCount(tx *bolt.Tx) {
+func checkSiafundCount(tx *bolt.Tx) error {
 	var total types.Currency
 	err := tx.Bucket(SiafundOutputs).ForEach(func(_, siafundOutputBytes []byte) error {
 		var sfo types.SiafundOutput
 		err := encoding.Unmarshal(siafundOutputBytes, &sfo)
 		if err != nil {
-			manageErr(tx, err)
+			return err
 		}
 		total = total.Add(sfo.Value)
 		return nil
 	})
 	if err != nil {
-		manageErr(tx, err)
+		return err
 	}
 	if total.Cmp(types.SiafundCount) != 0 {
-		manageErr(tx, errors.New("wrong number if siafunds in the consensus set"))
+		return errors.New("wrong number if siafunds in the consensus set")
 	}
+	return nil
 }
 
 // checkDSCOs scans the sets of delayed siacoin outputs and checks for
 // consistency.
-func checkDSCOs(tx *bolt.Tx) {
+func checkDSCOs(tx *bolt.Tx) error {
 	// Create a map to track which delayed siacoin output maps exist, and
 	// another map to track which ids have appeared in the dsco set.
 	dscoTracker := make(map[types.BlockHeight]struct{})
@@ -213,7 +254,7 @@ func checkDSCOs(tx *bolt.Tx) {
 		var height types.BlockHeight
 		err := encoding.Unmarshal(name[len(prefixDSCO):], &height)
 		if err != nil {
-			manageErr(tx, err)
+			return err
 		}
 		_, exists := dscoTracker[height]
 		if exists {
@@ -236,7 +277,7 @@ func checkDSCOs(tx *bolt.Tx) {
 			var sco types.SiacoinOutput
 			err := encoding.Unmarshal(delayedOutput, &sco)
 			if err != nil {
-				manageErr(tx, err)
+				return err
 			}
 			total = total.Add(sco.Value)
 			return nil
@@ -254,7 +295,7 @@ func checkDSCOs(tx *bolt.Tx) {
 		return nil
 	})
 	if err != nil {
-		manageErr(tx, err)
+		return err
 	}
 
 	// Check that all of the correct heights are represented.
@@ -266,13 +307,86 @@ func checkDSCOs(tx *bolt.Tx) {
 		}
 		_, exists := dscoTracker[i]
 		if !exists {
-			manageErr(tx, errors.New("missing a dsco bucket"))
+			return errors.New("missing a dsco bucket")
 		}
 		expectedBuckets++
 	}
 	if len(dscoTracker) != expectedBuckets {
-		manageErr(tx, errors.New("too many dsco buckets"))
+		return errors.New("too many dsco buckets")
+	}
+	return nil
+}
+
+// checkFileContracts checks that every file contract in the consensus set has
+// consistent window math and payouts, and that every file contract has exactly
+// one expiration entry.
+func checkFileContracts(tx *bolt.Tx) error {
+	currentHeight := blockHeight(tx)
+	numContracts := 0
+	err := tx.Bucket(FileContracts).ForEach(func(idBytes, fcBytes []byte) error {
+		var fc types.FileContract
+		err := encoding.Unmarshal(fcBytes, &fc)
+		if err != nil {
+			return err
+		}
+		numContracts++
+
+		// Check the window math. A contract is removed from the consensus set
+		// at its WindowEnd, so an open contract must end in the future.
+		if fc.WindowEnd <= fc.WindowStart {
+			return fmt.Errorf("file contract %x has a window that ends before it starts", idBytes)
+		}
+		if fc.WindowEnd <= currentHeight {
+			return fmt.Errorf("file contract %x is open after its window has ended", idBytes)
+		}
+
+		// Check that the valid and missed outputs spend the same volume of
+		// coins, and that the volume is covered by the payout.
+		var validSum, missedSum types.Currency
+		for _, output := range fc.ValidProofOutputs {
+			validSum = validSum.Add(output.Value)
+		}
+		for _, output := range fc.MissedProofOutputs {
+			missedSum = missedSum.Add(output.Value)
+		}
+		if validSum.Cmp(missedSum) != 0 {
+			return fmt.Errorf("file contract %x has mismatched valid and missed proof outputs", idBytes)
+		}
+		if validSum.Cmp(fc.Payout) > 0 {
+			return fmt.Errorf("file contract %x pays out more than it was funded with", idBytes)
+		}
+
+		// Check that the contract is scheduled to expire.
+		expirationBucketID := append(prefixFCEX, encoding.Marshal(fc.WindowEnd)...)
+		expirationBucket := tx.Bucket(expirationBucketID)
+		if expirationBucket == nil || expirationBucket.Get(idBytes) == nil {
+			return fmt.Errorf("file contract %x has no expiration entry", idBytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+
+	// Check that there are no expiration entries without a corresponding file
+	// contract.
+	numExpirations := 0
+	err = tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if !bytes.HasPrefix(name, prefixFCEX) {
+			return nil
+		}
+		return b.ForEach(func(_, _ []byte) error {
+			numExpirations++
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if numExpirations != numContracts {
+		return errors.New("number of file contract expirations does not match the number of file contracts")
+	}
+	return nil
 }
 
 // checkRevertApply reverts the most recent block, checking to see that the
@@ -309,6 +423,32 @@ func (cs *ConsensusSet) checkRevertApply(tx *bolt.Tx) {
 	}
 }
 
+// runChecks runs each of the checks against the consensus set, returning the
+// first violation found.
+func runChecks(tx *bolt.Tx, checks []func(*bolt.Tx) error) error {
+	for _, check := range checks {
+		err := check(tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkInvariants runs every invariant check against the consensus set,
+// returning the first violation found. On top of the checks made by
+// checkConsistency, it scans every open file contract and every siacoin
+// balance, which is too slow to do while blocks are being applied.
+func checkInvariants(tx *bolt.Tx) error {
+	return runChecks(tx, []func(*bolt.Tx) error{
+		checkDSCOs,
+		checkSiacoinCount,
+		checkSiacoinBalances,
+		checkSiafundCount,
+		checkFileContracts,
+	})
+}
+
 // checkConsistency runs a series of checks to make sure that the consensus set
 // is consistent with some rules that should always be true.
 func (cs *ConsensusSet) checkConsistency(tx *bolt.Tx) {
@@ -316,9 +456,14 @@ func (cs *ConsensusSet) checkConsistency(tx *bolt.Tx) {
 		return
 	}
 	cs.checkingConsistency = true
-	checkDSCOs(tx)
-	checkSiacoinCount(tx)
-	checkSiafundCount(tx)
+	err := runChecks(tx, []func(*bolt.Tx) error{
+		checkDSCOs,
+		checkSiacoinCount,
+		checkSiafundCount,
+	})
+	if err != nil {
+		manageErr(tx, err)
+	}
 	if build.DEBUG {
 		cs.checkRevertApply(tx)
 	}
@@ -338,6 +483,3 @@ func (cs *ConsensusSet) maybeCheckConsistency(tx *bolt.Tx) {
 		cs.checkConsistency(tx)
 	}
 }
-
-// TODO: Check that every file contract has an expiration too, and that the
-// number of file contracts + the number of expirations is equal.
@@ -0,0 +1,174 @@
+package consensus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+// TestVerifyInvariants corrupts the consensus set in a number of ways and
+// checks that VerifyInvariants detects each corruption.
+func TestVerifyInvariants(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		corrupt func(tx *bolt.Tx, fcid types.FileContractID, fc types.FileContract) error
+		errStr  string
+	}{
+		{
+			name: "ExtraSiacoinOutput",
+			corrupt: func(tx *bolt.Tx, _ types.FileContractID, _ types.FileContract) error {
+				addSiacoinOutput(tx, types.SiacoinOutputID{1}, types.SiacoinOutput{Value: types.NewCurrency64(1)})
+				return nil
+			},
+			errStr: "Wrong number of siacoins",
+		},
+		{
+			name: "WrongSiacoinBalance",
+			corrupt: func(tx *bolt.Tx, _ types.FileContractID, _ types.FileContract) error {
+				setSiacoinBalance(tx, types.UnlockHash{1}, types.NewCurrency64(1))
+				return nil
+			},
+			errStr: "siacoin balances contain unlock hashes without siacoin outputs",
+		},
+		{
+			name: "ExtraSiafundOutput",
+			corrupt: func(tx *bolt.Tx, _ types.FileContractID, _ types.FileContract) error {
+				// Start the claim at the current pool so that the siacoin
+				// count is unaffected.
+				addSiafundOutput(tx, types.SiafundOutputID{1}, types.SiafundOutput{
+					Value:      types.NewCurrency64(1),
+					ClaimStart: getSiafundPool(tx),
+				})
+				return nil
+			},
+			errStr: "wrong number if siafunds",
+		},
+		{
+			name: "InvertedWindow",
+			corrupt: func(tx *bolt.Tx, fcid types.FileContractID, fc types.FileContract) error {
+				fc.WindowStart = fc.WindowEnd
+				return tx.Bucket(FileContracts).Put(fcid[:], encoding.Marshal(fc))
+			},
+			errStr: "window that ends before it starts",
+		},
+		{
+			name: "MismatchedOutputs",
+			corrupt: func(tx *bolt.Tx, fcid types.FileContractID, fc types.FileContract) error {
+				fc.MissedProofOutputs[0].Value = fc.MissedProofOutputs[0].Value.Add(types.NewCurrency64(1))
+				return tx.Bucket(FileContracts).Put(fcid[:], encoding.Marshal(fc))
+			},
+			errStr: "mismatched valid and missed proof outputs",
+		},
+		{
+			name: "Underfunded",
+			corrupt: func(tx *bolt.Tx, fcid types.FileContractID, fc types.FileContract) error {
+				fc.Payout = fc.ValidProofOutputs[0].Value.Sub(types.NewCurrency64(1))
+				return tx.Bucket(FileContracts).Put(fcid[:], encoding.Marshal(fc))
+			},
+			errStr: "pays out more than it was funded with",
+		},
+		{
+			name: "MissingExpiration",
+			corrupt: func(tx *bolt.Tx, fcid types.FileContractID, fc types.FileContract) error {
+				expirationBucketID := append(prefixFCEX, encoding.Marshal(fc.WindowEnd)...)
+				return tx.Bucket(expirationBucketID).Delete(fcid[:])
+			},
+			errStr: "has no expiration entry",
+		},
+		{
+			name: "ExtraExpiration",
+			corrupt: func(tx *bolt.Tx, _ types.FileContractID, fc types.FileContract) error {
+				expirationBucketID := append(prefixFCEX, encoding.Marshal(fc.WindowEnd)...)
+				return tx.Bucket(expirationBucketID).Put([]byte{1}, []byte{})
+			},
+			errStr: "number of file contract expirations",
+		},
+	}
+	for _, test := range tests {
+		cst, err := createConsensusSetTester("TestVerifyInvariants - " + test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := crypto.RandBytes(4e3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fcid, _ := cst.addFileContract(file, types.NewCurrency64(400e6))
+		fc, err := cst.cs.dbGetFileContract(fcid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The consensus set should be consistent before it is corrupted.
+		err = cst.cs.VerifyInvariants()
+		if err != nil {
+			t.Fatal(test.name, "failed verification before corruption:", err)
+		}
+
+		err = cst.cs.db.Update(func(tx *bolt.Tx) error {
+			return test.corrupt(tx, fcid, fc)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cst.cs.VerifyInvariants()
+		if err == nil || !strings.Contains(err.Error(), test.errStr) {
+			t.Errorf("%v: expecting error containing %q, got %v", test.name, test.errStr, err)
+		}
+		cst.Close()
+	}
+}
+
+// TestConsistencyCheckSkipsInvariantScans checks that the consistency check
+// run while blocks are applied leaves the full scans to VerifyInvariants.
+func TestConsistencyCheckSkipsInvariantScans(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestConsistencyCheckSkipsInvariantScans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Corrupt the siacoin balances, which only the full scans look at.
+	err = cst.cs.db.Update(func(tx *bolt.Tx) error {
+		setSiacoinBalance(tx, types.UnlockHash{1}, types.NewCurrency64(1))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The consistency check panics if it finds a violation while debugging.
+	err = cst.cs.db.Update(func(tx *bolt.Tx) error {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Error("the consistency check ran the siacoin balance scan:", r)
+			}
+		}()
+		cst.cs.checkConsistency(tx)
+		if inconsistencyDetected(tx) {
+			t.Error("the consistency check marked the consensus set as inconsistent")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cst.cs.VerifyInvariants()
+	if err == nil {
+		t.Error("VerifyInvariants did not detect the corrupted siacoin balances")
+	}
+}
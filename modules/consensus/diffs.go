@@ -181,6 +181,9 @@ func updateCurrentPath(tx *bolt.Tx, pb *processedBlock, dir modules.DiffDirectio
 	} else {
 		popPath(tx)
 	}
+
+	// The storage proof receipts track the proofs in the current path.
+	updateStorageProofReceipts(tx, pb, dir)
 }
 
 // commitDiffSet applies or reverts the diffs in a blockNode.
@@ -5,12 +5,14 @@ import (
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 
 	"github.com/NebulousLabs/bolt"
 )
 
 var (
 	errExternalRevert = errors.New("cannot revert to block outside of current path")
+	errUnknownForkTip = errors.New("fork tip is not in the block map")
 )
 
 // backtrackToCurrentPath traces backwards from 'pb' until it reaches a block
@@ -114,3 +116,70 @@ func (cs *ConsensusSet) forkBlockchain(tx *bolt.Tx, newBlock *processedBlock) (r
 	}
 	return revertedBlocks, appliedBlocks, nil
 }
+
+// simulateFork moves the current path onto the fork ending at 'pb' inside a
+// transaction that the caller rolls back. Unlike forkBlockchain, it has no
+// effect outside of the transaction: fork blocks that are already known to be
+// invalid are rejected up front, blocks found to be invalid are not added to
+// the dosBlocks, and the consistency checks are skipped.
+func (cs *ConsensusSet) simulateFork(tx *bolt.Tx, pb *processedBlock) error {
+	newPath := backtrackToCurrentPath(tx, pb)
+	for _, block := range newPath[1:] {
+		if _, exists := cs.dosBlocks[block.Block.ID()]; exists {
+			return errDoSBlock
+		}
+	}
+
+	for currentBlockID(tx) != newPath[0].Block.ID() {
+		commitDiffSet(tx, currentProcessedBlock(tx), modules.DiffRevert)
+	}
+	for _, block := range newPath[1:] {
+		if block.DiffsGenerated {
+			commitDiffSet(tx, block, modules.DiffApply)
+			continue
+		}
+		err := generateAndApplyDiff(tx, block)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SimulateReorgImpact reports how moving the current path onto the fork ending
+// at 'forkTip' would change the status of a file contract. The fork tip must
+// already be in the block map, but does not need to be heavier than the
+// current path. The reorg happens inside a database transaction that is
+// always rolled back, so the consensus set is left unchanged, and an invalid
+// fork is reported without being marked as invalid.
+//
+// The status of the file contract is read from the stored file contracts and
+// storage proof receipts on either side of the reorg, so the cost of the
+// simulation is that of reverting and applying the blocks between the common
+// parent and the two tips. Only a read lock is held, but the simulation
+// still waits on, and holds up, other database writes.
+func (cs *ConsensusSet) SimulateReorgImpact(forkTip types.BlockID, fcid types.FileContractID) (delta ContractDelta, err error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	// Boltdb only rolls back a tx if an error is returned, so errSuccess is
+	// returned when the simulation succeeds. See TryTransactionSet.
+	errSuccess := errors.New("success")
+	err = cs.db.Update(func(tx *bolt.Tx) error {
+		pb, err := getBlockMap(tx, forkTip)
+		if err != nil {
+			return errUnknownForkTip
+		}
+		delta.Before = contractStatus(tx, fcid)
+		err = cs.simulateFork(tx, pb)
+		if err != nil {
+			return err
+		}
+		delta.After = contractStatus(tx, fcid)
+		return errSuccess
+	})
+	if err != errSuccess {
+		return ContractDelta{}, err
+	}
+	return delta, nil
+}
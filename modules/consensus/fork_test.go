@@ -3,7 +3,9 @@ package consensus
 import (
 	"testing"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // TestBacktrackToCurrentPath probes the backtrackToCurrentPath method of the
@@ -103,3 +105,124 @@ func TestRevertToNode(t *testing.T) {
 	}()
 	cst.cs.dbRevertToNode(pb)
 }
+
+// TestIntegrationSimulateReorgImpact checks that SimulateReorgImpact reports
+// a fork that turns a missed storage proof into a hit, without changing the
+// consensus set.
+func TestIntegrationSimulateReorgImpact(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestIntegrationSimulateReorgImpact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Create a file contract and solve a block containing its storage proof,
+	// but keep the block out of the consensus set for now.
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid, _ := cst.addFileContract(file, types.NewCurrency64(400e6))
+	txnBuilder := cst.wallet.StartTransaction()
+	txnBuilder.AddStorageProof(cst.storageProof(fcid, file))
+	txnSet, err := txnBuilder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, target, err := cst.miner.BlockForWork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Transactions = append(block.Transactions, txnSet...)
+	proofBlock, _ := cst.miner.SolveBlock(block, target)
+
+	// Mine past the end of the proof window so that the contract is missed.
+	for i := 0; i < 3; i++ {
+		_, err = cst.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = cst.cs.dbGetFileContract(fcid)
+	if err == nil {
+		t.Fatal("file contract is still open after its window closed")
+	}
+	if _, exists := cst.cs.StorageProofReceipt(fcid); exists {
+		t.Fatal("missed file contract has a storage proof receipt")
+	}
+
+	// Add the proof block as a fork and simulate moving onto it.
+	err = cst.cs.AcceptBlock(proofBlock)
+	if err != modules.ErrNonExtendingBlock {
+		t.Fatal(err)
+	}
+	currentID := cst.cs.dbCurrentBlockID()
+	checksum := cst.cs.dbConsensusChecksum()
+	delta, err := cst.cs.SimulateReorgImpact(proofBlock.ID(), fcid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delta.Before.Open || delta.Before.Proven {
+		t.Error("contract should be missed before the reorg:", delta.Before)
+	}
+	if delta.After.Open || !delta.After.Proven {
+		t.Error("contract should be proven after the reorg:", delta.After)
+	}
+
+	// The consensus set should be unchanged.
+	if cst.cs.dbCurrentBlockID() != currentID || cst.cs.dbConsensusChecksum() != checksum {
+		t.Error("simulating a reorg changed the consensus set")
+	}
+	if _, exists := cst.cs.StorageProofReceipt(fcid); exists {
+		t.Error("simulated storage proof leaked into the consensus set")
+	}
+
+	// A fork that is found to be invalid during the simulation is reported,
+	// but not marked as invalid.
+	block, target, err = cst.miner.BlockForWork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.ParentID = proofBlock.ID()
+	block.Transactions = []types.Transaction{{
+		SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID{1}}},
+	}}
+	target, _ = cst.cs.ChildTarget(proofBlock.ID())
+	badBlock, _ := cst.miner.SolveBlock(block, target)
+	err = cst.cs.AcceptBlock(badBlock)
+	if err != modules.ErrNonExtendingBlock {
+		t.Fatal(err)
+	}
+	_, err = cst.cs.SimulateReorgImpact(badBlock.ID(), fcid)
+	if err != errMissingSiacoinOutput {
+		t.Error("expected errMissingSiacoinOutput, got", err)
+	}
+	cst.cs.mu.RLock()
+	_, marked := cst.cs.dosBlocks[badBlock.ID()]
+	cst.cs.mu.RUnlock()
+	if marked {
+		t.Error("simulating an invalid fork added it to the dos blocks")
+	}
+	if cst.cs.dbCurrentBlockID() != currentID || cst.cs.dbConsensusChecksum() != checksum {
+		t.Error("simulating an invalid fork changed the consensus set")
+	}
+
+	// Fork tips that are known to be invalid are rejected.
+	cst.cs.mu.Lock()
+	cst.cs.dosBlocks[badBlock.ID()] = struct{}{}
+	cst.cs.mu.Unlock()
+	_, err = cst.cs.SimulateReorgImpact(badBlock.ID(), fcid)
+	if err != errDoSBlock {
+		t.Error("expected errDoSBlock, got", err)
+	}
+
+	// Unknown fork tips are rejected.
+	_, err = cst.cs.SimulateReorgImpact(types.BlockID{}, fcid)
+	if err != errUnknownForkTip {
+		t.Error("expected errUnknownForkTip, got", err)
+	}
+}
@@ -1,5 +1,81 @@
 package consensus
 
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+// TestApplyFileContractMaintenanceSeeded seeds the consensus set with many
+// file contracts and checks that maintenance expires exactly the contracts
+// whose windows have ended.
+func TestApplyFileContractMaintenanceSeeded(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestApplyFileContractMaintenanceSeeded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Seed 300 file contracts, half of which expire one block before the
+	// others.
+	height := cst.cs.dbBlockHeight()
+	payout := types.NewCurrency64(10e3)
+	var fcs []types.FileContract
+	for i := 0; i < 300; i++ {
+		windowEnd := height + 2
+		if i%2 == 1 {
+			windowEnd = height + 3
+		}
+		fcs = append(fcs, types.FileContract{
+			WindowStart:        height + 1,
+			WindowEnd:          windowEnd,
+			Payout:             payout,
+			ValidProofOutputs:  []types.SiacoinOutput{{Value: types.PostTax(height, payout)}},
+			MissedProofOutputs: []types.SiacoinOutput{{Value: types.PostTax(height, payout), UnlockHash: randAddress()}},
+		})
+	}
+	fcids := cst.cs.dbSeedFileContracts(fcs)
+
+	// Apply file contract maintenance for the height at which the first half
+	// of the contracts expire.
+	pb := &processedBlock{Height: height + 2}
+	err = cst.cs.db.Update(func(tx *bolt.Tx) error {
+		createDSCOBucket(tx, pb.Height+types.MaturityDelay)
+		applyFileContractMaintenance(tx, pb)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pb.FileContractDiffs) != 150 || len(pb.DelayedSiacoinOutputDiffs) != 150 {
+		t.Fatal("wrong number of diffs from file contract maintenance")
+	}
+	for i, fcid := range fcids {
+		_, err := cst.cs.dbGetFileContract(fcid)
+		if i%2 == 0 && err != errNilItem {
+			t.Error("file contract", i, "remains after expiration")
+		} else if i%2 == 1 && err != nil {
+			t.Error("file contract", i, "was expired early")
+		}
+		if i%2 == 1 {
+			continue
+		}
+		dsco, err := cst.cs.dbGetDSCO(pb.Height+types.MaturityDelay, fcid.StorageProofOutputID(types.ProofMissed, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dsco.UnlockHash != fcs[i].MissedProofOutputs[0].UnlockHash {
+			t.Error("missed proof output of file contract", i, "has the wrong unlock hash")
+		}
+	}
+}
+
 /*
 import (
 	"testing"
@@ -49,6 +49,21 @@ func (cs *ConsensusSet) loadDB() error {
 		if genesisID != cs.blockRoot.Block.ID() {
 			return errors.New("Blockchain has wrong genesis block, exiting.")
 		}
+
+		// Databases created before siacoin balances were tracked need to have
+		// the balances computed from the siacoin output set.
+		if tx.Bucket(SiacoinBalances) == nil {
+			err = initSiacoinBalances(tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Databases created before storage proof receipts were stored need to
+		// have the receipts collected from the current path.
+		if tx.Bucket(StorageProofReceipts) == nil {
+			return initStorageProofReceipts(tx)
+		}
 		return nil
 	})
 }
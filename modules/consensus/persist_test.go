@@ -5,8 +5,13 @@ import (
 	"testing"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/gateway"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
 )
 
 // TestSaveLoad populates a blockchain, saves it, loads it, and checks
@@ -41,3 +46,121 @@ func TestSaveLoad(t *testing.T) {
 		t.Fatal("consensus set hash changed after load")
 	}
 }
+
+// TestStorageProofReceiptsUpgrade checks that the storage proof receipts are
+// rebuilt when a database created before receipts were stored is loaded.
+func TestStorageProofReceiptsUpgrade(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestStorageProofReceiptsUpgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid, _ := cst.addFileContract(file, types.NewCurrency64(400e6))
+	cst.submitStorageProof(fcid, file)
+	receipt, exists := cst.cs.StorageProofReceipt(fcid)
+	if !exists {
+		t.Fatal("no receipt for an accepted storage proof")
+	}
+
+	// Delete the receipts bucket to simulate an old database, then reload the
+	// consensus set.
+	err = cst.cs.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(StorageProofReceipts)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cst.cs.Close()
+	g, err := gateway.New("localhost:0", build.TempDir(modules.ConsensusDir, "TestStorageProofReceiptsUpgrade", modules.GatewayDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	d := filepath.Join(build.SiaTestingDir, modules.ConsensusDir, "TestStorageProofReceiptsUpgrade", modules.ConsensusDir)
+	cst.cs, err = New(g, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upgradedReceipt, exists := cst.cs.StorageProofReceipt(fcid)
+	if !exists || upgradedReceipt != receipt {
+		t.Error("receipt was not restored by the upgrade")
+	}
+	err = cst.cs.VerifyInvariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSiacoinBalancesUpgrade checks that the siacoin balances are rebuilt
+// from the siacoin output set when a database created before balances were
+// tracked is loaded.
+func TestSiacoinBalancesUpgrade(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestSiacoinBalancesUpgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Delete the balances bucket to simulate an old database, then reload the
+	// consensus set.
+	err = cst.cs.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(SiacoinBalances)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cst.cs.Close()
+	g, err := gateway.New("localhost:0", build.TempDir(modules.ConsensusDir, "TestSiacoinBalancesUpgrade", modules.GatewayDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	d := filepath.Join(build.SiaTestingDir, modules.ConsensusDir, "TestSiacoinBalancesUpgrade", modules.ConsensusDir)
+	cst.cs, err = New(g, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cst.cs.VerifyInvariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sum the siacoin outputs by unlock hash and compare against the rebuilt
+	// balances.
+	expected := make(map[types.UnlockHash]types.Currency)
+	err = cst.cs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(SiacoinOutputs).ForEach(func(_, scoBytes []byte) error {
+			var sco types.SiacoinOutput
+			err := encoding.Unmarshal(scoBytes, &sco)
+			if err != nil {
+				return err
+			}
+			expected[sco.UnlockHash] = expected[sco.UnlockHash].Add(sco.Value)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) == 0 {
+		t.Fatal("tester has no siacoin outputs")
+	}
+	for uh, balance := range expected {
+		if cst.cs.SiacoinBalance(uh).Cmp(balance) != 0 {
+			t.Errorf("balance of %v is %v after the upgrade, expected %v", uh, cst.cs.SiacoinBalance(uh), balance)
+		}
+	}
+}
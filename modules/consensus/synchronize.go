@@ -207,25 +207,21 @@ func (cs *ConsensusSet) threadedReceiveBlocks(conn modules.PeerConn) (returnErr
 			return err
 		}
 
-		// Integrate the blocks into the consensus set.
-		for _, block := range newBlocks {
+		// Integrate the blocks into the consensus set. Call managedAcceptBlocks
+		// instead of AcceptBlock so as not to broadcast every block.
+		// ErrNonExtendingBlock must be ignored until headers-first block
+		// sharing is implemented, block already in database should also be
+		// ignored; managedAcceptBlocks skips both.
+		if len(newBlocks) > 0 {
 			stalled = false
-			// Call managedAcceptBlock instead of AcceptBlock so as not to broadcast
-			// every block.
-			acceptErr := cs.managedAcceptBlock(block)
-			// Set a flag to indicate that we should broadcast the last block received.
-			if acceptErr == nil {
-				chainExtended = true
-			}
-			// ErrNonExtendingBlock must be ignored until headers-first block
-			// sharing is implemented, block already in database should also be
-			// ignored.
-			if acceptErr == modules.ErrNonExtendingBlock || acceptErr == modules.ErrBlockKnown {
-				acceptErr = nil
-			}
-			if acceptErr != nil {
-				return acceptErr
-			}
+		}
+		accepted, acceptErr := cs.managedAcceptBlocks(newBlocks)
+		// Set a flag to indicate that we should broadcast the last block received.
+		if accepted > 0 {
+			chainExtended = true
+		}
+		if acceptErr != nil {
+			return acceptErr
 		}
 	}
 	return nil
@@ -13,17 +13,21 @@ import (
 	"github.com/NebulousLabs/bolt"
 )
 
+const (
+	// terminatedFileContractDepth is the number of recent blocks searched
+	// when deciding whether a missing file contract was terminated or never
+	// existed.
+	terminatedFileContractDepth = 10
+)
+
 var (
 	errAlteredRevisionPayouts     = errors.New("file contract revision has altered payout volume")
-	errInvalidStorageProof        = errors.New("provided storage proof is invalid")
 	errLateRevision               = errors.New("file contract revision submitted after deadline")
 	errLowRevisionNumber          = errors.New("transaction has a file contract with an outdated revision number")
 	errMissingSiacoinOutput       = errors.New("transaction spends a nonexisting siacoin output")
 	errMissingSiafundOutput       = errors.New("transaction spends a nonexisting siafund output")
 	errSiacoinInputOutputMismatch = errors.New("siacoin inputs do not equal siacoin outputs for transaction")
 	errSiafundInputOutputMismatch = errors.New("siafund inputs do not equal siafund outputs for transaction")
-	errUnfinishedFileContract     = errors.New("file contract window has not yet openend")
-	errUnrecognizedFileContractID = errors.New("cannot fetch storage proof segment for unknown file contract")
 	errWrongUnlockConditions      = errors.New("transaction contains incorrect unlock conditions")
 )
 
@@ -57,14 +61,42 @@ func validSiacoins(tx *bolt.Tx, t types.Transaction) error {
 	return nil
 }
 
-// storageProofSegment returns the index of the segment that needs to be proven
-// exists in a file contract.
-func storageProofSegment(tx *bolt.Tx, fcid types.FileContractID) (uint64, error) {
+// fileContractTerminated returns true if the file contract was removed from
+// the consensus set within the most recent terminatedFileContractDepth blocks.
+// It is only used by the storage proof getters to pick a more helpful error for
+// a missing file contract, and is kept off the validation path because it
+// loads several blocks.
+func fileContractTerminated(tx *bolt.Tx, fcid types.FileContractID) bool {
+	pb := currentProcessedBlock(tx)
+	for i := 0; i < terminatedFileContractDepth; i++ {
+		// The most recent diff for the file contract decides whether it was
+		// removed; a revision reverts the old contract and then applies the
+		// new one.
+		for j := len(pb.FileContractDiffs) - 1; j >= 0; j-- {
+			if pb.FileContractDiffs[j].ID == fcid {
+				return pb.FileContractDiffs[j].Direction == modules.DiffRevert
+			}
+		}
+		if pb.Height == 0 {
+			break
+		}
+		parent, err := getBlockMap(tx, pb.Block.ParentID)
+		if build.DEBUG && err != nil {
+			panic(err)
+		}
+		pb = parent
+	}
+	return false
+}
+
+// storageProofTrigger returns the id of the block used to seed the storage
+// proof segment of a file contract, along with the file contract.
+func storageProofTrigger(tx *bolt.Tx, fcid types.FileContractID) (types.BlockID, types.FileContract, error) {
 	// Check that the parent file contract exists.
 	fcBucket := tx.Bucket(FileContracts)
 	fcBytes := fcBucket.Get(fcid[:])
 	if fcBytes == nil {
-		return 0, errUnrecognizedFileContractID
+		return types.BlockID{}, types.FileContract{}, modules.ErrUnrecognizedFileContractID
 	}
 
 	// Decode the file contract.
@@ -74,15 +106,38 @@ func storageProofSegment(tx *bolt.Tx, fcid types.FileContractID) (uint64, error)
 		panic(err)
 	}
 
-	// Get the trigger block id.
+	// Get the trigger block id. The trigger block is the block immediately
+	// preceding the proof window, which is the genesis block for a contract
+	// with a WindowStart of 1. A valid contract can never have a WindowStart
+	// of 0, but the genesis block is used for that case as well rather than
+	// letting the trigger height underflow.
 	blockPath := tx.Bucket(BlockPath)
 	triggerHeight := fc.WindowStart - 1
+	if fc.WindowStart == 0 {
+		triggerHeight = 0
+	}
 	if triggerHeight > blockHeight(tx) {
-		return 0, errUnfinishedFileContract
+		return types.BlockID{}, types.FileContract{}, modules.ErrUnfinishedFileContract
 	}
 	var triggerID types.BlockID
 	copy(triggerID[:], blockPath.Get(encoding.EncUint64(uint64(triggerHeight))))
+	return triggerID, fc, nil
+}
 
+// storageProofSegment returns the index of the segment that needs to be proven
+// exists in a file contract.
+func storageProofSegment(tx *bolt.Tx, fcid types.FileContractID) (uint64, error) {
+	triggerID, fc, err := storageProofTrigger(tx, fcid)
+	if err != nil {
+		return 0, err
+	}
+	return segmentIndex(triggerID, fcid, fc.FileSize), nil
+}
+
+// segmentIndex derives the storage proof segment of a file contract from its
+// trigger block. It depends only on its inputs, so that other implementations
+// can be checked against it directly.
+func segmentIndex(triggerID types.BlockID, fcid types.FileContractID, fileSize uint64) uint64 {
 	// Get the index by appending the file contract ID to the trigger block and
 	// taking the hash, then converting the hash to a numerical value and
 	// modding it against the number of segments in the file. The result is a
@@ -92,10 +147,9 @@ func storageProofSegment(tx *bolt.Tx, fcid types.FileContractID) (uint64, error)
 	// being modded, the difference is too small to make any practical
 	// difference.
 	seed := crypto.HashAll(triggerID, fcid)
-	numSegments := int64(crypto.CalculateLeaves(fc.FileSize))
+	numSegments := int64(crypto.CalculateLeaves(fileSize))
 	seedInt := new(big.Int).SetBytes(seed[:])
-	index := seedInt.Mod(seedInt, big.NewInt(numSegments)).Uint64()
-	return index, nil
+	return seedInt.Mod(seedInt, big.NewInt(numSegments)).Uint64()
 }
 
 // validStorageProofsPre100e3 runs the code that was running before height
@@ -153,7 +207,7 @@ func validStorageProofs100e3(tx *bolt.Tx, t types.Transaction) error {
 			fc.FileMerkleRoot,
 		)
 		if !verified {
-			return errInvalidStorageProof
+			return modules.ErrInvalidStorageProof
 		}
 	}
 
@@ -190,7 +244,15 @@ func validStorageProofs(tx *bolt.Tx, t types.Transaction) error {
 			segmentLen = uint64(crypto.SegmentSize)
 		}
 
-		verified := crypto.VerifySegment(
+		// Reject hash sets of the wrong length before doing any hashing. A
+		// hash set of the wrong length can never verify, so this does not
+		// change which proofs are valid. Proofs for empty files are exempt,
+		// as they are accepted without verification.
+		if fc.FileSize > 0 && uint64(len(sp.HashSet)) != crypto.ProofLength(leaves, segmentIndex) {
+			return modules.ErrInvalidStorageProof
+		}
+
+		verified := crypto.VerifySegmentStream(
 			sp.Segment[:segmentLen],
 			sp.HashSet,
 			leaves,
@@ -198,7 +260,7 @@ func validStorageProofs(tx *bolt.Tx, t types.Transaction) error {
 			fc.FileMerkleRoot,
 		)
 		if !verified && fc.FileSize > 0 {
-			return errInvalidStorageProof
+			return modules.ErrInvalidStorageProof
 		}
 	}
 
@@ -2,9 +2,12 @@ package consensus
 
 import (
 	"crypto/rand"
+	"errors"
+	"math/big"
 	"testing"
 
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 
 	"github.com/NebulousLabs/bolt"
@@ -406,7 +409,7 @@ func TestStorageProofSegment(t *testing.T) {
 
 	// Submit a file contract that is unrecognized.
 	_, err = cst.cs.dbStorageProofSegment(types.FileContractID{})
-	if err != errUnrecognizedFileContractID {
+	if err != modules.ErrUnrecognizedFileContractID {
 		t.Error(err)
 	}
 
@@ -416,11 +419,395 @@ func TestStorageProofSegment(t *testing.T) {
 		WindowStart: 100000,
 	})
 	_, err = cst.cs.dbStorageProofSegment(types.FileContractID{})
-	if err != errUnfinishedFileContract {
+	if err != modules.ErrUnfinishedFileContract {
 		t.Error(err)
 	}
 }
 
+// TestStorageProofSegmentTrigger checks that the trigger block used to pick
+// the storage proof segment is well defined for contracts whose window starts
+// at or near the genesis block.
+func TestStorageProofSegmentTrigger(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestStorageProofSegmentTrigger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// expectedSegment computes the segment that should be chosen for a file
+	// contract with 100 segments, given the height of its trigger block.
+	expectedSegment := func(triggerHeight types.BlockHeight, fcid types.FileContractID) uint64 {
+		triggerID, err := cst.cs.dbGetPath(triggerHeight)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seed := crypto.HashAll(triggerID, fcid)
+		seedInt := new(big.Int).SetBytes(seed[:])
+		return seedInt.Mod(seedInt, big.NewInt(100)).Uint64()
+	}
+
+	tests := []struct {
+		windowStart   types.BlockHeight
+		triggerHeight types.BlockHeight
+	}{
+		{0, 0}, // unreachable for valid contracts, but must not underflow
+		{1, 0},
+		{2, 1},
+	}
+	for i, test := range tests {
+		fcid := types.FileContractID{byte(i + 1)}
+		cst.cs.dbAddFileContract(fcid, types.FileContract{
+			FileSize:    100 * crypto.SegmentSize,
+			Payout:      types.NewCurrency64(1),
+			WindowStart: test.windowStart,
+			WindowEnd:   test.windowStart + 1,
+		})
+		index, err := cst.cs.dbStorageProofSegment(fcid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index != expectedSegment(test.triggerHeight, fcid) {
+			t.Errorf("wrong segment for WindowStart %v", test.windowStart)
+		}
+	}
+
+	// A contract whose trigger block is far in the future should not have a
+	// segment yet.
+	fcid := types.FileContractID{byte(len(tests) + 1)}
+	cst.cs.dbAddFileContract(fcid, types.FileContract{
+		FileSize:    100 * crypto.SegmentSize,
+		Payout:      types.NewCurrency64(1),
+		WindowStart: 1e9,
+		WindowEnd:   1e9 + 1,
+	})
+	_, err = cst.cs.dbStorageProofSegment(fcid)
+	if err != modules.ErrUnfinishedFileContract {
+		t.Error("expecting ErrUnfinishedFileContract, got", err)
+	}
+}
+
+// TestSegmentIndexVectors checks the storage proof segment derivation against
+// a fixed set of vectors. The seed is the hash of the trigger block id
+// followed by the file contract id, and the segment is the seed, read as a
+// big-endian integer, modulo the number of segments in the file. Other
+// implementations must produce the same seeds and segments.
+func TestSegmentIndexVectors(t *testing.T) {
+	tests := []struct {
+		triggerID types.BlockID
+		fcid      types.FileContractID
+		fileSize  uint64
+		seed      string
+		segment   uint64
+	}{
+		{types.BlockID{}, types.FileContractID{}, 1, "0eb923b0cbd24df54401d998531feead35a47a99f4deed205de4af81120f9761", 0},
+		{types.BlockID{}, types.FileContractID{}, 100 * crypto.SegmentSize, "0eb923b0cbd24df54401d998531feead35a47a99f4deed205de4af81120f9761", 21},
+		{types.BlockID{1}, types.FileContractID{}, 100 * crypto.SegmentSize, "a8808b58ceffeabe057a36b030cd57ec5164db3a534ac20834cce83b06e7033a", 18},
+		{types.BlockID{}, types.FileContractID{1}, 100 * crypto.SegmentSize, "cdbf6f09931206f105dbd759561f36aff7676f5eec7fe6e027473cea643250f7", 35},
+		{types.BlockID{1}, types.FileContractID{2}, 1 << 22, "78e5e778eeb4f10f474ee0b96561667de1d0a14bea82cb81bf34ce2a14d9fdf2", 65010},
+		{types.BlockID{1}, types.FileContractID{2}, 1<<22 + 1, "78e5e778eeb4f10f474ee0b96561667de1d0a14bea82cb81bf34ce2a14d9fdf2", 41981},
+	}
+	for i, test := range tests {
+		seed := crypto.HashAll(test.triggerID, test.fcid)
+		if seed.String() != test.seed {
+			t.Errorf("vector %v: expected seed %v, got %v", i, test.seed, seed)
+		}
+		if segment := segmentIndex(test.triggerID, test.fcid, test.fileSize); segment != test.segment {
+			t.Errorf("vector %v: expected segment %v, got %v", i, test.segment, segment)
+		}
+	}
+}
+
+// TestStorageProofBeforeWindow submits a storage proof one block before the
+// proof window of the file contract opens, checking that the proof is
+// rejected as unfinished rather than being verified against a bogus segment.
+func TestStorageProofBeforeWindow(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestStorageProofBeforeWindow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+	for cst.cs.dbBlockHeight() <= 10 {
+		_, err = cst.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Add two file contracts for the same file, one whose trigger block is
+	// the current block and one whose trigger block is the next block.
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	height := cst.cs.dbBlockHeight()
+	openID, earlyID := types.FileContractID{1}, types.FileContractID{2}
+	fc := types.FileContract{
+		FileSize:       uint64(len(file)),
+		FileMerkleRoot: crypto.MerkleRoot(file),
+		Payout:         types.NewCurrency64(1),
+		WindowStart:    height + 1,
+		WindowEnd:      height + 5,
+	}
+	cst.cs.dbAddFileContract(openID, fc)
+	fc.WindowStart = height + 2
+	cst.cs.dbAddFileContract(earlyID, fc)
+
+	// A proof for the open contract is accepted.
+	sp := cst.storageProof(openID, file)
+	err = cst.cs.dbValidStorageProofs(types.Transaction{StorageProofs: []types.StorageProof{sp}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same proof submitted one block before the window opens is rejected
+	// as unfinished.
+	sp.ParentID = earlyID
+	err = cst.cs.dbValidStorageProofs(types.Transaction{StorageProofs: []types.StorageProof{sp}})
+	if !errors.Is(err, modules.ErrUnfinishedFileContract) {
+		t.Fatal("expecting ErrUnfinishedFileContract, got", err)
+	}
+}
+
+// TestTerminatedFileContractProof checks that the storage proof getters
+// distinguish recently terminated file contracts from unknown file contracts.
+func TestTerminatedFileContractProof(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestTerminatedFileContractProof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Create a file contract and let it expire without a storage proof.
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid, fc := cst.addFileContract(file, types.NewCurrency64(400e6))
+	sp := cst.storageProof(fcid, file)
+	for cst.cs.dbBlockHeight() < fc.WindowEnd {
+		_, err = cst.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = cst.cs.dbGetFileContract(fcid)
+	if err != errNilItem {
+		t.Fatal("file contract did not expire")
+	}
+
+	// Validation does not look for the termination, and only reports that the
+	// contract is missing.
+	txn := types.Transaction{StorageProofs: []types.StorageProof{sp}}
+	err = cst.cs.dbValidStorageProofs(txn)
+	if err != modules.ErrUnrecognizedFileContractID {
+		t.Error("expecting ErrUnrecognizedFileContractID, got", err)
+	}
+
+	// Asking for the segment of the just-terminated contract should report
+	// the termination.
+	_, err = cst.cs.StorageProofSegment(fcid)
+	if err != modules.ErrTerminatedFileContract {
+		t.Error("expecting ErrTerminatedFileContract, got", err)
+	}
+	_, err = cst.cs.StorageProofTrigger(fcid)
+	if err != modules.ErrTerminatedFileContract {
+		t.Error("expecting ErrTerminatedFileContract, got", err)
+	}
+
+	// Once the termination is old enough, the contract is unrecognized.
+	for i := 0; i < terminatedFileContractDepth; i++ {
+		_, err = cst.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = cst.cs.StorageProofSegment(fcid)
+	if err != modules.ErrUnrecognizedFileContractID {
+		t.Error("expecting ErrUnrecognizedFileContractID, got", err)
+	}
+}
+
+// TestStorageProofTrigger checks that StorageProofTrigger returns the block
+// that was used to pick the storage proof segment.
+func TestStorageProofTrigger(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestStorageProofTrigger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Unknown file contracts have no trigger.
+	_, err = cst.cs.StorageProofTrigger(types.FileContractID{})
+	if err != modules.ErrUnrecognizedFileContractID {
+		t.Error("expecting ErrUnrecognizedFileContractID, got", err)
+	}
+
+	// Create a file contract whose window is open.
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid, fc := cst.addFileContract(file, types.NewCurrency64(400e6))
+	triggerID, err := cst.cs.StorageProofTrigger(fcid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pathID, err := cst.cs.dbGetPath(fc.WindowStart - 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if triggerID != pathID {
+		t.Error("trigger is not the block preceding the proof window")
+	}
+
+	// The trigger should reproduce the segment used by the consensus set.
+	segmentIndex, err := cst.cs.StorageProofSegment(fcid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := crypto.HashAll(triggerID, fcid)
+	seedInt := new(big.Int).SetBytes(seed[:])
+	numSegments := big.NewInt(int64(crypto.CalculateLeaves(fc.FileSize)))
+	if seedInt.Mod(seedInt, numSegments).Uint64() != segmentIndex {
+		t.Error("trigger does not reproduce the storage proof segment")
+	}
+
+	// Contracts whose window has not opened have no trigger.
+	unfinishedID := types.FileContractID{1}
+	cst.cs.dbAddFileContract(unfinishedID, types.FileContract{
+		Payout:      types.NewCurrency64(1),
+		WindowStart: 1e9,
+		WindowEnd:   1e9 + 1,
+	})
+	_, err = cst.cs.StorageProofTrigger(unfinishedID)
+	if err != modules.ErrUnfinishedFileContract {
+		t.Error("expecting ErrUnfinishedFileContract, got", err)
+	}
+}
+
+// TestStorageProofHashSetLength checks that storage proofs with too few or
+// too many hashes are rejected.
+func TestStorageProofHashSetLength(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestStorageProofHashSetLength")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid, _ := cst.addFileContract(file, types.NewCurrency64(400e6))
+	sp := cst.storageProof(fcid, file)
+	err = cst.cs.dbValidStorageProofs(types.Transaction{StorageProofs: []types.StorageProof{sp}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop the last hash from the hash set.
+	shortSP := sp
+	shortSP.HashSet = sp.HashSet[:len(sp.HashSet)-1]
+	err = cst.cs.dbValidStorageProofs(types.Transaction{StorageProofs: []types.StorageProof{shortSP}})
+	if err != modules.ErrInvalidStorageProof {
+		t.Error("expecting ErrInvalidStorageProof for a short hash set, got", err)
+	}
+
+	// Add extra hashes to the hash set.
+	longSP := sp
+	longSP.HashSet = append(append([]crypto.Hash(nil), sp.HashSet...), make([]crypto.Hash, 1e3)...)
+	err = cst.cs.dbValidStorageProofs(types.Transaction{StorageProofs: []types.StorageProof{longSP}})
+	if err != modules.ErrInvalidStorageProof {
+		t.Error("expecting ErrInvalidStorageProof for a long hash set, got", err)
+	}
+}
+
+// TestStorageProofErrors checks that the storage proof validation errors can
+// be identified by callers using the exported sentinel errors.
+func TestStorageProofErrors(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	cst, err := createConsensusSetTester("TestStorageProofErrors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Create a file contract with an open proof window.
+	file, err := crypto.RandBytes(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid, fc := cst.addFileContract(file, types.NewCurrency64(400e6))
+
+	// Submit a corrupted storage proof.
+	sp := cst.storageProof(fcid, file)
+	sp.Segment[0]++
+	_, err = cst.cs.TryTransactionSet([]types.Transaction{{StorageProofs: []types.StorageProof{sp}}})
+	if !errors.Is(err, modules.ErrInvalidStorageProof) {
+		t.Error("expecting ErrInvalidStorageProof, got", err)
+	}
+
+	// Submit a proof for a contract that does not exist.
+	sp = cst.storageProof(fcid, file)
+	sp.ParentID = types.FileContractID{}
+	_, err = cst.cs.TryTransactionSet([]types.Transaction{{StorageProofs: []types.StorageProof{sp}}})
+	if !errors.Is(err, modules.ErrUnrecognizedFileContractID) {
+		t.Error("expecting ErrUnrecognizedFileContractID, got", err)
+	}
+
+	// Submit a proof for the contract twice. The contract is removed once the
+	// first proof is accepted.
+	sp = cst.storageProof(fcid, file)
+	cst.submitStorageProof(fcid, file)
+	_, err = cst.cs.TryTransactionSet([]types.Transaction{{StorageProofs: []types.StorageProof{sp}}})
+	if !errors.Is(err, modules.ErrUnrecognizedFileContractID) {
+		t.Error("expecting ErrUnrecognizedFileContractID, got", err)
+	}
+
+	// Request a proof for a contract whose window has not opened.
+	unfinishedID := types.FileContractID{1}
+	cst.cs.dbAddFileContract(unfinishedID, types.FileContract{
+		Payout:      types.NewCurrency64(1),
+		WindowStart: 100000,
+	})
+	_, err = cst.cs.StorageProofSegment(unfinishedID)
+	if !errors.Is(err, modules.ErrUnfinishedFileContract) {
+		t.Error("expecting ErrUnfinishedFileContract, got", err)
+	}
+
+	// Submit a file contract whose outputs are not funded by the payout.
+	fc.WindowStart = cst.cs.dbBlockHeight() + 2
+	fc.WindowEnd = fc.WindowStart + 1
+	fc.ValidProofOutputs[0].Value = fc.ValidProofOutputs[0].Value.Add(types.NewCurrency64(1))
+	_, err = cst.cs.TryTransactionSet([]types.Transaction{{FileContracts: []types.FileContract{fc}}})
+	if !errors.Is(err, types.ErrFileContractOutputSumViolation) {
+		t.Error("expecting ErrFileContractOutputSumViolation, got", err)
+	}
+}
+
 // TestValidStorageProofs probes the validStorageProofs method of the consensus
 // set.
 func TestValidStorageProofs(t *testing.T) {
@@ -491,14 +878,14 @@ func TestValidStorageProofs(t *testing.T) {
 	}
 	copy(txn.StorageProofs[0].Segment[:], base)
 	err = cst.cs.dbValidStorageProofs(txn)
-	if err != errInvalidStorageProof {
+	if err != modules.ErrInvalidStorageProof {
 		t.Error(err)
 	}
 
 	// Try to validate a proof for a file contract that doesn't exist.
 	txn.StorageProofs[0].ParentID = types.FileContractID{}
 	err = cst.cs.dbValidStorageProofs(txn)
-	if err != errUnrecognizedFileContractID {
+	if err != modules.ErrUnrecognizedFileContractID {
 		t.Error(err)
 	}
 
@@ -597,7 +984,7 @@ func TestPreForkValidStorageProofs(t *testing.T) {
 	}
 	copy(txn.StorageProofs[0].Segment[:], base)
 	err = cst.cs.dbValidStorageProofs(txn)
-	if err != errInvalidStorageProof {
+	if err != modules.ErrInvalidStorageProof {
 		t.Log(cst.cs.dbBlockHeight())
 		t.Fatal(err)
 	}
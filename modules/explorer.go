@@ -10,7 +10,24 @@ const (
 	ExplorerDir = "explorer"
 )
 
+const (
+	// ContractOutputValid is an output paid when a storage proof is submitted
+	// for the contract.
+	ContractOutputValid ContractOutputKind = iota
+
+	// ContractOutputMissed is an output paid when the proof window of the
+	// contract closes without a storage proof.
+	ContractOutputMissed
+
+	// ContractOutputTreasury is the treasury's cut of a valid proof output.
+	ContractOutputTreasury
+)
+
 type (
+	// A ContractOutputKind identifies which payout of a file contract created
+	// a siacoin output.
+	ContractOutputKind int
+
 	// BlockFacts returns a bunch of statistics about the consensus set as they
 	// were at a specific block.
 	BlockFacts struct {
@@ -75,6 +92,13 @@ type (
 		// the provided siacoin output id.
 		SiacoinOutputID(types.SiacoinOutputID) []types.TransactionID
 
+		// ContractOutput returns the file contract that pays out the provided
+		// siacoin output, and whether the output is a valid proof, missed
+		// proof, or treasury payout. Only the payouts of the latest revision
+		// of the contract are reported. The bool is false if the output is not
+		// a file contract payout.
+		ContractOutput(types.SiacoinOutputID) (types.FileContractID, ContractOutputKind, bool)
+
 		// FileContractHistory returns the history associated with a file
 		// contract, which includes the file contract itself and all of the
 		// revisions that have been submitted to the blockchain. The first bool
@@ -17,6 +17,7 @@ var (
 	bucketBlockIDs              = []byte("BlockIDs")
 	bucketBlocksDifficulty      = []byte("BlocksDifficulty")
 	bucketBlockTargets          = []byte("BlockTargets")
+	bucketContractOutputs       = []byte("ContractOutputs")
 	bucketFileContractHistories = []byte("FileContractHistories")
 	bucketFileContractIDs       = []byte("FileContractIDs")
 	bucketSiacoinOutputIDs      = []byte("SiacoinOutputIDs")
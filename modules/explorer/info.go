@@ -88,6 +88,46 @@ func (e *Explorer) SiacoinOutputID(id types.SiacoinOutputID) []types.Transaction
 	return ids
 }
 
+// ContractOutput reports whether the siacoin output is a payout of a file
+// contract, returning the contract and the kind of payout. The contract is
+// looked up in the contract output index, and the output is then checked
+// against the proof outputs of the latest revision of the contract, so outputs
+// dropped by a later revision are not reported. Treasury outputs are only
+// reported for valid proof outputs that the treasury takes a cut of.
+//
+// Contract terminations do not exist in this version of the protocol, so no
+// output is classified as a termination payout.
+func (e *Explorer) ContractOutput(id types.SiacoinOutputID) (fcid types.FileContractID, kind modules.ContractOutputKind, exists bool) {
+	err := e.db.View(dbGetAndDecode(bucketContractOutputs, id, &fcid))
+	if err != nil {
+		return types.FileContractID{}, 0, false
+	}
+	fc, fcrs, fcE, _ := e.FileContractHistory(fcid)
+	if !fcE {
+		return types.FileContractID{}, 0, false
+	}
+	valid, missed := fc.ValidProofOutputs, fc.MissedProofOutputs
+	if len(fcrs) > 0 {
+		valid = fcrs[len(fcrs)-1].NewValidProofOutputs
+		missed = fcrs[len(fcrs)-1].NewMissedProofOutputs
+	}
+
+	for i, sco := range valid {
+		if fcid.StorageProofOutputID(types.ProofValid, uint64(i)) == id {
+			return fcid, modules.ContractOutputValid, true
+		}
+		if fcid.StorageProofTreasuryOutputID(uint64(i)) == id && !types.TreasuryCut(sco.Value).IsZero() {
+			return fcid, modules.ContractOutputTreasury, true
+		}
+	}
+	for i := range missed {
+		if fcid.StorageProofOutputID(types.ProofMissed, uint64(i)) == id {
+			return fcid, modules.ContractOutputMissed, true
+		}
+	}
+	return types.FileContractID{}, 0, false
+}
+
 // FileContractHistory returns the history associated with the specified file
 // contract ID, which includes the file contract itself and all of the
 // revisions that have been submitted to the blockchain. The first bool
@@ -3,6 +3,7 @@ package explorer
 import (
 	"testing"
 
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -69,3 +70,107 @@ func TestBlockFacts(t *testing.T) {
 		t.Error("call to 'BlockFacts' has failed")
 	}
 }
+
+// TestContractOutput checks that the explorer classifies the payouts of a file
+// contract, and does not classify ordinary outputs as contract payouts.
+func TestContractOutput(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	et, err := createExplorerTester("TestContractOutput")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Put a file contract with two valid proof outputs and one missed proof
+	// output into the chain. The contract can be revised without signatures.
+	payout := types.NewCurrency64(5e9)
+	builder := et.wallet.StartTransaction()
+	err = builder.FundSiacoins(payout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	postTax := types.PostTax(et.cs.Height(), payout)
+	fc := types.FileContract{
+		FileSize:           5e3,
+		WindowStart:        et.cs.Height() + 5,
+		WindowEnd:          et.cs.Height() + 6,
+		Payout:             payout,
+		ValidProofOutputs:  []types.SiacoinOutput{{Value: postTax.Sub(types.NewCurrency64(1e6))}, {Value: types.NewCurrency64(1e6)}},
+		MissedProofOutputs: []types.SiacoinOutput{{Value: postTax}},
+		UnlockHash:         types.UnlockConditions{}.UnlockHash(),
+	}
+	fcIndex := builder.AddFileContract(fc)
+	txns, err := builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = et.tpool.AcceptTransactionSet(txns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := et.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid := txns[len(txns)-1].FileContractID(fcIndex)
+
+	// The treasury takes a cut of every valid proof output in testing.
+	tests := []struct {
+		id   types.SiacoinOutputID
+		kind modules.ContractOutputKind
+	}{
+		{fcid.StorageProofOutputID(types.ProofValid, 0), modules.ContractOutputValid},
+		{fcid.StorageProofOutputID(types.ProofValid, 1), modules.ContractOutputValid},
+		{fcid.StorageProofOutputID(types.ProofMissed, 0), modules.ContractOutputMissed},
+		{fcid.StorageProofTreasuryOutputID(0), modules.ContractOutputTreasury},
+		{fcid.StorageProofTreasuryOutputID(1), modules.ContractOutputTreasury},
+	}
+	for _, test := range tests {
+		id, kind, exists := et.explorer.ContractOutput(test.id)
+		if !exists || id != fcid || kind != test.kind {
+			t.Errorf("output %v misclassified: got %v, %v, %v", test.id, id, kind, exists)
+		}
+	}
+
+	// Miner payouts, ordinary outputs, and unknown outputs are not contract
+	// payouts.
+	for _, id := range []types.SiacoinOutputID{b.MinerPayoutID(0), txns[0].SiacoinOutputID(0), {}} {
+		if _, _, exists := et.explorer.ContractOutput(id); exists {
+			t.Error("output classified as a contract payout:", id)
+		}
+	}
+
+	// Revise the contract down to a single valid proof output. The outputs
+	// dropped by the revision are no longer contract payouts.
+	fcr := types.FileContractRevision{
+		ParentID:              fcid,
+		NewRevisionNumber:     1,
+		NewFileSize:           fc.FileSize,
+		NewWindowStart:        fc.WindowStart,
+		NewWindowEnd:          fc.WindowEnd,
+		NewValidProofOutputs:  []types.SiacoinOutput{{Value: postTax}},
+		NewMissedProofOutputs: fc.MissedProofOutputs,
+		NewUnlockHash:         fc.UnlockHash,
+	}
+	err = et.tpool.AcceptTransactionSet([]types.Transaction{{FileContractRevisions: []types.FileContractRevision{fcr}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = et.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{0, 2, 3} {
+		test := tests[i]
+		id, kind, exists := et.explorer.ContractOutput(test.id)
+		if !exists || id != fcid || kind != test.kind {
+			t.Errorf("output %v misclassified after revision: got %v, %v, %v", test.id, id, kind, exists)
+		}
+	}
+	for _, id := range []types.SiacoinOutputID{fcid.StorageProofOutputID(types.ProofValid, 1), fcid.StorageProofTreasuryOutputID(1)} {
+		if _, _, exists := et.explorer.ContractOutput(id); exists {
+			t.Error("output dropped by a revision classified as a contract payout:", id)
+		}
+	}
+}
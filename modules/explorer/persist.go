@@ -39,6 +39,7 @@ func (e *Explorer) initPersist() error {
 			bucketBlockIDs,
 			bucketBlocksDifficulty,
 			bucketBlockTargets,
+			bucketContractOutputs,
 			bucketFileContractHistories,
 			bucketFileContractIDs,
 			bucketInternal,
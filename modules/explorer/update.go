@@ -84,6 +84,7 @@ func (e *Explorer) ProcessConsensusChange(cc modules.ConsensusChange) {
 						dbRemoveSiacoinOutputID(tx, scoid, txid)
 						dbRemoveUnlockHash(tx, sco.UnlockHash, txid)
 					}
+					dbRemoveContractOutputs(tx, fcid, fc.ValidProofOutputs, fc.MissedProofOutputs)
 					dbRemoveFileContract(tx, fcid)
 				}
 				for _, fcr := range txn.FileContractRevisions {
@@ -171,6 +172,7 @@ func (e *Explorer) ProcessConsensusChange(cc modules.ConsensusChange) {
 					dbAddFileContractID(tx, fcid, txid)
 					dbAddUnlockHash(tx, fc.UnlockHash, txid)
 					dbAddFileContract(tx, fcid, fc)
+					dbAddContractOutputs(tx, fcid, fc.ValidProofOutputs, fc.MissedProofOutputs)
 					for l, sco := range fc.ValidProofOutputs {
 						scoid := fcid.StorageProofOutputID(types.ProofValid, uint64(l))
 						dbAddSiacoinOutputID(tx, scoid, txid)
@@ -197,6 +199,7 @@ func (e *Explorer) ProcessConsensusChange(cc modules.ConsensusChange) {
 						dbAddUnlockHash(tx, sco.UnlockHash, txid)
 					}
 					dbAddFileContractRevision(tx, fcr.ParentID, fcr)
+					dbAddContractOutputs(tx, fcr.ParentID, fcr.NewValidProofOutputs, fcr.NewMissedProofOutputs)
 				}
 				for _, sp := range txn.StorageProofs {
 					dbAddFileContractID(tx, sp.ParentID, txid)
@@ -323,6 +326,31 @@ func dbRemoveFileContract(tx *bolt.Tx, id types.FileContractID) {
 	mustDelete(tx.Bucket(bucketFileContractHistories), id)
 }
 
+// Add/Remove the contract that pays out each proof and treasury output. An
+// output id can only derive from one contract, and ContractOutput checks each
+// entry against the latest revision of the contract, so the entries added by
+// a revision are not removed when the revision is reverted.
+func dbAddContractOutputs(tx *bolt.Tx, fcid types.FileContractID, valid, missed []types.SiacoinOutput) {
+	b := tx.Bucket(bucketContractOutputs)
+	for i := range valid {
+		mustPut(b, fcid.StorageProofOutputID(types.ProofValid, uint64(i)), fcid)
+		mustPut(b, fcid.StorageProofTreasuryOutputID(uint64(i)), fcid)
+	}
+	for i := range missed {
+		mustPut(b, fcid.StorageProofOutputID(types.ProofMissed, uint64(i)), fcid)
+	}
+}
+func dbRemoveContractOutputs(tx *bolt.Tx, fcid types.FileContractID, valid, missed []types.SiacoinOutput) {
+	b := tx.Bucket(bucketContractOutputs)
+	for i := range valid {
+		mustDelete(b, fcid.StorageProofOutputID(types.ProofValid, uint64(i)))
+		mustDelete(b, fcid.StorageProofTreasuryOutputID(uint64(i)))
+	}
+	for i := range missed {
+		mustDelete(b, fcid.StorageProofOutputID(types.ProofMissed, uint64(i)))
+	}
+}
+
 // Add/Remove txid from file contract ID bucket
 func dbAddFileContractID(tx *bolt.Tx, id types.FileContractID, txid types.TransactionID) {
 	b, err := tx.Bucket(bucketFileContractIDs).CreateBucketIfNotExists(encoding.Marshal(id))
@@ -502,6 +530,12 @@ func dbAddGenesisBlock(tx *bolt.Tx) {
 	dbAddBlockID(tx, id, 0)
 	txid := types.GenesisBlock.Transactions[0].ID()
 	dbAddTransactionID(tx, txid, 0)
+	for i, sco := range types.GenesisSiacoinAllocation {
+		scoid := types.GenesisBlock.Transactions[0].SiacoinOutputID(uint64(i))
+		dbAddSiacoinOutputID(tx, scoid, txid)
+		dbAddUnlockHash(tx, sco.UnlockHash, txid)
+		dbAddSiacoinOutput(tx, scoid, sco)
+	}
 	for i, sfo := range types.GenesisSiafundAllocation {
 		sfoid := types.GenesisBlock.Transactions[0].SiafundOutputID(uint64(i))
 		dbAddSiafundOutputID(tx, sfoid, txid)
@@ -514,8 +548,9 @@ func dbAddGenesisBlock(tx *bolt.Tx) {
 			Height:             0,
 			Difficulty:         types.RootTarget.Difficulty(),
 			Target:             types.RootTarget,
-			TotalCoins:         types.CalculateCoinbase(0),
+			TotalCoins:         types.CalculateNumSiacoins(0),
 			TransactionCount:   1,
+			SiacoinOutputCount: uint64(len(types.GenesisSiacoinAllocation)),
 			SiafundOutputCount: uint64(len(types.GenesisSiafundAllocation)),
 		},
 		Timestamp: types.GenesisBlock.Timestamp,
@@ -1,6 +1,8 @@
 package modules
 
 import (
+	"io"
+
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -40,6 +42,7 @@ type (
 		RiskedStorageCollateral types.Currency `json:"riskedstoragecollateral"`
 		StorageRevenue          types.Currency `json:"storagerevenue"`
 		TransactionFeeExpenses  types.Currency `json:"transactionfeeexpenses"`
+		TreasuryExpenses        types.Currency `json:"treasuryexpenses"`
 
 		// Bandwidth financial metrics.
 		DownloadBandwidthRevenue          types.Currency `json:"downloadbandwidthrevenue"`
@@ -89,6 +92,10 @@ type (
 		// AnnounceAddress submits an announcement using the given address.
 		AnnounceAddress(NetAddress) error
 
+		// ExportObligations writes the host's storage obligations to the
+		// writer as CSV, for use by external accounting tools.
+		ExportObligations(io.Writer) error
+
 		// ExternalSettings returns the settings of the host as seen by an
 		// untrusted node querying the host for settings.
 		ExternalSettings() HostExternalSettings
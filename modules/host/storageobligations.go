@@ -29,8 +29,11 @@ package host
 
 import (
 	"encoding/binary"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
@@ -107,8 +110,35 @@ var (
 	errNoStorageObligation = errors.New("storage obligation not found in database")
 )
 
+// obligationExportHeader lists the columns written by ExportObligations. New
+// columns should only be appended so that existing consumers keep working.
+var obligationExportHeader = []string{
+	"id",
+	"status",
+	"expiration",
+	"proof_deadline",
+	"value",
+	"locked_collateral",
+	"valid_host_payout",
+}
+
 type storageObligationStatus uint64
 
+// String returns the name of a storage obligation status.
+func (sos storageObligationStatus) String() string {
+	switch sos {
+	case obligationUnresolved:
+		return "unresolved"
+	case obligationRejected:
+		return "rejected"
+	case obligationSucceeded:
+		return "succeeded"
+	case obligationFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
 // storageObligation contains all of the metadata related to a file contract
 // and the storage contained by the file contract.
 type storageObligation struct {
@@ -566,6 +596,11 @@ func (h *Host) removeStorageObligation(so *storageObligation, sos storageObligat
 		h.financialMetrics.StorageRevenue = h.financialMetrics.StorageRevenue.Add(so.PotentialStorageRevenue)
 		h.financialMetrics.DownloadBandwidthRevenue = h.financialMetrics.DownloadBandwidthRevenue.Add(so.PotentialDownloadRevenue)
 		h.financialMetrics.UploadBandwidthRevenue = h.financialMetrics.UploadBandwidthRevenue.Add(so.PotentialUploadRevenue)
+
+		// Part of the valid proof output of the host is diverted to the
+		// treasury when the storage proof is accepted.
+		validPayouts, _ := so.payouts()
+		h.financialMetrics.TreasuryExpenses = h.financialMetrics.TreasuryExpenses.Add(types.TreasuryCut(validPayouts[1].Value))
 	}
 	if sos == obligationFailed {
 		// Remove the obligation statistics as potential risk and income.
@@ -817,3 +852,73 @@ func (h *Host) unlockStorageObligation(so *storageObligation) error {
 	delete(h.lockedStorageObligations, so.id())
 	return nil
 }
+
+// checkExportable returns an error if the storage obligation is missing the
+// file contract or the host payout that ExportObligations reports.
+func (so *storageObligation) checkExportable() error {
+	if len(so.OriginTransactionSet) == 0 {
+		return errInsaneOriginSetSize
+	}
+	fcs := so.OriginTransactionSet[len(so.OriginTransactionSet)-1].FileContracts
+	if len(fcs) == 0 {
+		return errInsaneOriginSetFileContract
+	}
+	if len(so.RevisionTransactionSet) > 0 {
+		revisions := so.RevisionTransactionSet[len(so.RevisionTransactionSet)-1].FileContractRevisions
+		if len(revisions) == 0 {
+			return errInsaneRevisionSetRevisionCount
+		}
+		if len(revisions[0].NewValidProofOutputs) < 2 {
+			return errInsaneFileContractRevisionOutputCounts
+		}
+		return nil
+	}
+	if len(fcs[0].ValidProofOutputs) < 2 {
+		return errInsaneFileContractOutputCounts
+	}
+	return nil
+}
+
+// ExportObligations writes every storage obligation held by the host to w as
+// CSV, with a header row followed by one row per obligation in order of file
+// contract id. Obligations that have finished are included so that their
+// final status is recorded. The export fails rather than writing a partial
+// row if an obligation is malformed.
+func (h *Host) ExportObligations(w io.Writer) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	cw := csv.NewWriter(w)
+	err := cw.Write(obligationExportHeader)
+	if err != nil {
+		return err
+	}
+	err = h.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketStorageObligations).ForEach(func(_, soBytes []byte) error {
+			var so storageObligation
+			err := json.Unmarshal(soBytes, &so)
+			if err != nil {
+				return err
+			}
+			err = so.checkExportable()
+			if err != nil {
+				return err
+			}
+			valid, _ := so.payouts()
+			return cw.Write([]string{
+				so.id().String(),
+				so.ObligationStatus.String(),
+				fmt.Sprint(so.expiration()),
+				fmt.Sprint(so.proofDeadline()),
+				so.value().String(),
+				so.LockedCollateral.String(),
+				valid[1].Value.String(),
+			})
+		})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
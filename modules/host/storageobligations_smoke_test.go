@@ -6,6 +6,9 @@ package host
 // correctly.
 
 import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
 	"testing"
 
 	"github.com/NebulousLabs/Sia/crypto"
@@ -593,49 +596,35 @@ func TestMultiSectorStorageObligationStack(t *testing.T) {
 	}
 }
 
-// TestAutoRevisionSubmission checks that the host correctly submits a file
-// contract revision to the consensus set.
-func TestAutoRevisionSubmission(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
-	t.Parallel()
-	ht, err := newHostTester("TestAutoRevisionSubmission")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer ht.Close()
-
-	// Start by adding a storage obligation to the host. To emulate conditions
-	// of a renter creating the first contract, the storage obligation has no
-	// data, but does have money.
+// addTesterSectorObligation adds a storage obligation to the host, then
+// revises it to hold a single random sector that the renter pays sectorCost
+// for. The proof window of the revision ends 'windowExtension' blocks after
+// the window of the original file contract. The revision is stored by the
+// host but not submitted to the transaction pool. The obligation is returned
+// unlocked, along with the sector cost and the revision transaction set.
+func (ht *hostTester) addTesterSectorObligation(windowExtension types.BlockHeight) (*storageObligation, types.Currency, []types.Transaction, error) {
 	so, err := ht.newTesterStorageObligation()
 	if err != nil {
-		t.Fatal(err)
+		return nil, types.Currency{}, nil, err
 	}
 	err = ht.host.lockStorageObligation(so)
 	if err != nil {
-		t.Fatal(err)
+		return nil, types.Currency{}, nil, err
 	}
 	err = ht.host.addStorageObligation(so)
 	if err != nil {
-		t.Fatal(err)
+		return nil, types.Currency{}, nil, err
 	}
 	err = ht.host.unlockStorageObligation(so)
 	if err != nil {
-		t.Fatal(err)
-	}
-	// Storage obligation should not be marked as having the transaction
-	// confirmed on the blockchain.
-	if so.OriginConfirmed {
-		t.Fatal("storage obligation should not yet be marked as confirmed, confirmation is on the way")
+		return nil, types.Currency{}, nil, err
 	}
 
 	// Add a file contract revision, moving over a small amount of money to pay
-	// for the file contract.
+	// for the sector.
 	sectorRoot, sectorData, err := randSector()
 	if err != nil {
-		t.Fatal(err)
+		return nil, types.Currency{}, nil, err
 	}
 	so.SectorRoots = []crypto.Hash{sectorRoot}
 	sectorCost := types.SiacoinPrecision.Mul64(550)
@@ -655,7 +644,7 @@ func TestAutoRevisionSubmission(t *testing.T) {
 			NewFileSize:           uint64(len(sectorData)),
 			NewFileMerkleRoot:     sectorRoot,
 			NewWindowStart:        so.expiration(),
-			NewWindowEnd:          so.proofDeadline(),
+			NewWindowEnd:          so.proofDeadline() + windowExtension,
 			NewValidProofOutputs:  validPayouts,
 			NewMissedProofOutputs: missedPayouts,
 			NewUnlockHash:         types.UnlockConditions{}.UnlockHash(),
@@ -664,16 +653,43 @@ func TestAutoRevisionSubmission(t *testing.T) {
 	so.RevisionTransactionSet = revisionSet
 	err = ht.host.lockStorageObligation(so)
 	if err != nil {
-		t.Fatal(err)
+		return nil, types.Currency{}, nil, err
 	}
 	err = ht.host.modifyStorageObligation(so, nil, []crypto.Hash{sectorRoot}, [][]byte{sectorData})
 	if err != nil {
-		t.Fatal(err)
+		return nil, types.Currency{}, nil, err
 	}
 	err = ht.host.unlockStorageObligation(so)
+	if err != nil {
+		return nil, types.Currency{}, nil, err
+	}
+	return so, sectorCost, revisionSet, nil
+}
+
+// TestAutoRevisionSubmission checks that the host correctly submits a file
+// contract revision to the consensus set.
+func TestAutoRevisionSubmission(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := newHostTester("TestAutoRevisionSubmission")
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer ht.Close()
+
+	// Start by adding a storage obligation to the host, and a revision that
+	// stores a single sector.
+	so, sectorCost, _, err := ht.addTesterSectorObligation(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Storage obligation should not be marked as having the transaction
+	// confirmed on the blockchain.
+	if so.OriginConfirmed {
+		t.Fatal("storage obligation should not yet be marked as confirmed, confirmation is on the way")
+	}
 	// Unlike the other tests, this test does not submit the file contract
 	// revision to the transaction pool for the host, the host is expected to
 	// do it automatically.
@@ -732,4 +748,230 @@ func TestAutoRevisionSubmission(t *testing.T) {
 	if ht.host.financialMetrics.StorageRevenue.Cmp(sectorCost) != 0 {
 		t.Fatal("the host should be reporting revenue after a successful storage proof")
 	}
+	validPayouts, _ := so.payouts()
+	treasuryCut := types.TreasuryCut(validPayouts[1].Value)
+	if treasuryCut.IsZero() || ht.host.financialMetrics.TreasuryExpenses.Cmp(treasuryCut) != 0 {
+		t.Error("the host is not reporting the treasury cut of its valid proof output:", ht.host.financialMetrics.TreasuryExpenses)
+	}
+}
+
+// TestExportObligations adds a storage obligation to the host and checks that
+// the exported CSV matches the obligation in the database.
+func TestExportObligations(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := newHostTester("TestExportObligations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	so, err := ht.newTesterStorageObligation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ht.host.lockStorageObligation(so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ht.host.addStorageObligation(so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ht.host.unlockStorageObligation(so)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = ht.host.ExportObligations(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatal("expected a header and one row, got", len(records))
+	}
+	for i, column := range obligationExportHeader {
+		if records[0][i] != column {
+			t.Errorf("column %v is %q, expected %q", i, records[0][i], column)
+		}
+	}
+
+	// Cross-check the row against the database.
+	var dbso storageObligation
+	err = ht.host.db.View(func(tx *bolt.Tx) error {
+		dbso, err = getStorageObligation(tx, so.id())
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, _ := dbso.payouts()
+	expected := []string{
+		dbso.id().String(),
+		"unresolved",
+		fmt.Sprint(dbso.expiration()),
+		fmt.Sprint(dbso.proofDeadline()),
+		dbso.value().String(),
+		dbso.LockedCollateral.String(),
+		valid[1].Value.String(),
+	}
+	for i := range expected {
+		if records[1][i] != expected[i] {
+			t.Errorf("%v is %q, expected %q", obligationExportHeader[i], records[1][i], expected[i])
+		}
+	}
+}
+
+// TestExportMalformedObligation checks that ExportObligations returns an error
+// instead of panicking when an obligation has no host payout.
+func TestExportMalformedObligation(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := newHostTester("TestExportMalformedObligation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	// Write an obligation whose file contract has a single valid proof output
+	// directly to the database.
+	so, err := ht.newTesterStorageObligation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := &so.OriginTransactionSet[len(so.OriginTransactionSet)-1].FileContracts[0]
+	fc.ValidProofOutputs = fc.ValidProofOutputs[:1]
+	err = ht.host.db.Update(func(tx *bolt.Tx) error {
+		return putStorageObligation(tx, *so)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = ht.host.ExportObligations(&buf)
+	if err != errInsaneFileContractOutputCounts {
+		t.Fatal("expected errInsaneFileContractOutputCounts, got", err)
+	}
+}
+
+// TestReorgedStorageProofResubmission checks that the host resubmits a storage
+// proof when the block containing the proof is reorged out of the blockchain.
+func TestReorgedStorageProofResubmission(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := newHostTester("TestReorgedStorageProofResubmission")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	// Add a storage obligation with a single sector. The revision extends the
+	// proof window so that there is time to resubmit the proof after the
+	// reorg.
+	so, _, revisionSet, err := ht.addTesterSectorObligation(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ht.tpool.AcceptTransactionSet(revisionSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mine until the storage proof is confirmed.
+	proofConfirmed := func() bool {
+		var confirmed bool
+		err := ht.host.db.View(func(tx *bolt.Tx) error {
+			dbso, err := getStorageObligation(tx, so.id())
+			confirmed = dbso.ProofConfirmed
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return confirmed
+	}
+	for !proofConfirmed() {
+		if ht.cs.Height() > so.proofDeadline() {
+			t.Fatal("storage proof was never confirmed")
+		}
+		_, err = ht.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Find the block containing the storage proof.
+	proofHeight := ht.cs.Height()
+	for ; proofHeight > 0; proofHeight-- {
+		b, _ := ht.cs.BlockAtHeight(proofHeight)
+		var found bool
+		for _, txn := range b.Transactions {
+			for _, sp := range txn.StorageProofs {
+				found = found || sp.ParentID == so.id()
+			}
+		}
+		if found {
+			break
+		}
+	}
+
+	// Build a longer chain on the parent of the proof block that does not
+	// contain the storage proof.
+	parent, _ := ht.cs.BlockAtHeight(proofHeight - 1)
+	parentID := parent.ID()
+	forkHeight := ht.cs.Height() + 1
+	for height := proofHeight; height <= forkHeight; height++ {
+		b := types.Block{
+			ParentID:  parentID,
+			Timestamp: types.CurrentTimestamp(),
+		}
+		b.MinerPayouts = []types.SiacoinOutput{{Value: b.CalculateSubsidy(height)}}
+		target, _ := ht.cs.ChildTarget(parentID)
+		solved := false
+		for !solved {
+			b, solved = ht.miner.SolveBlock(b, target)
+		}
+		err = ht.cs.AcceptBlock(b)
+		if err != nil && err != modules.ErrNonExtendingBlock {
+			t.Fatal(err)
+		}
+		parentID = b.ID()
+	}
+	if ht.cs.CurrentBlock().ID() != parentID {
+		t.Fatal("the consensus set did not reorg to the longer chain")
+	}
+	if proofConfirmed() {
+		t.Fatal("storage proof is still confirmed after being reorged out")
+	}
+
+	// The host should have resubmitted the proof, which confirms again in the
+	// next block.
+	var resubmitted bool
+	for _, txn := range ht.tpool.TransactionList() {
+		for _, sp := range txn.StorageProofs {
+			resubmitted = resubmitted || sp.ParentID == so.id()
+		}
+	}
+	if !resubmitted {
+		t.Fatal("host did not resubmit the reorged storage proof")
+	}
+	_, err = ht.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proofConfirmed() {
+		t.Error("resubmitted storage proof was not confirmed")
+	}
 }
@@ -113,6 +113,7 @@ func (h *Host) ProcessConsensusChange(cc modules.ConsensusChange) {
 	// Wrap the whole parsing into a single large database tx to keep things
 	// efficient.
 	var actionItems []*storageObligation
+	revertedProofs := make(map[types.FileContractID]struct{})
 	err = h.db.Update(func(tx *bolt.Tx) error {
 		for _, block := range cc.RevertedBlocks {
 			// Look for transactions relevant to open storage obligations.
@@ -173,6 +174,7 @@ func (h *Host) ProcessConsensusChange(cc modules.ConsensusChange) {
 						if err != nil {
 							continue
 						}
+						revertedProofs[sp.ParentID] = struct{}{}
 					}
 				}
 			}
@@ -288,6 +290,26 @@ func (h *Host) ProcessConsensusChange(cc modules.ConsensusChange) {
 				}
 			}
 		}
+
+		// The transaction pool does not retry transactions from reverted
+		// blocks, so any storage proof that was reverted and not confirmed
+		// again by the applied blocks needs to be resubmitted by the host.
+		for soid := range revertedProofs {
+			so, err := getStorageObligation(tx, soid)
+			if err != nil || so.ProofConfirmed {
+				continue
+			}
+			var queued bool
+			for _, ai := range actionItems {
+				if ai.id() == soid {
+					queued = true
+					break
+				}
+			}
+			if !queued {
+				actionItems = append(actionItems, &so)
+			}
+		}
 		return nil
 	})
 	if err != nil {
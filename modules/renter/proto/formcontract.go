@@ -17,29 +17,17 @@ const (
 	estTxnSize = 2048
 )
 
-// FormContract forms a contract with a host and submits the contract
-// transaction to tpool.
-func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool transactionPool) (modules.RenterContract, error) {
-	// extract vars from params, for convenience
+// QuoteContract computes the file contract that FormContract proposes to the
+// host, along with the amount the renter must fund. The renter pays the host's
+// storage price for every byte of 'Filesize' over every block from
+// 'StartHeight' to 'EndHeight', plus the host's contract price, and covers
+// the siafund fee on the host's collateral as well. The host's collateral is
+// priced the same way and capped at its MaxCollateral. The unlock hash of the
+// contract is left empty, as it depends on the keys used to form it.
+func QuoteContract(params ContractParams) (types.FileContract, types.Currency, error) {
 	host, filesize, startHeight, endHeight, refundAddress := params.Host, params.Filesize, params.StartHeight, params.EndHeight, params.RefundAddress
 
-	// create our key
-	ourSK, ourPK, err := crypto.GenerateKeyPair()
-	if err != nil {
-		return modules.RenterContract{}, err
-	}
-	ourPublicKey := types.SiaPublicKey{
-		Algorithm: types.SignatureEd25519,
-		Key:       ourPK[:],
-	}
-	// create unlock conditions
-	uc := types.UnlockConditions{
-		PublicKeys:         []types.SiaPublicKey{ourPublicKey, host.PublicKey},
-		SignaturesRequired: 2,
-	}
-
 	// calculate cost to renter and cost to host
-	// TODO: clarify/abstract this math
 	storageAllocation := host.StoragePrice.Mul64(filesize).Mul64(uint64(endHeight - startHeight))
 	hostCollateral := host.Collateral.Mul64(filesize).Mul64(uint64(endHeight - startHeight))
 	if hostCollateral.Cmp(host.MaxCollateral) > 0 {
@@ -53,17 +41,15 @@ func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool tr
 
 	// check for negative currency
 	if types.PostTax(startHeight, payout).Cmp(hostPayout) < 0 {
-		return modules.RenterContract{}, errors.New("payout smaller than host payout")
+		return types.FileContract{}, types.Currency{}, errors.New("payout smaller than host payout")
 	}
 
-	// create file contract
 	fc := types.FileContract{
 		FileSize:       0,
 		FileMerkleRoot: crypto.Hash{}, // no proof possible without data
 		WindowStart:    endHeight,
 		WindowEnd:      endHeight + host.WindowSize,
 		Payout:         payout,
-		UnlockHash:     uc.UnlockHash(),
 		RevisionNumber: 0,
 		ValidProofOutputs: []types.SiacoinOutput{
 			// outputs need to account for tax
@@ -80,6 +66,36 @@ func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool tr
 			{Value: types.ZeroCurrency, UnlockHash: types.UnlockHash{}},
 		},
 	}
+	return fc, renterCost, nil
+}
+
+// FormContract forms a contract with a host and submits the contract
+// transaction to tpool.
+func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool transactionPool) (modules.RenterContract, error) {
+	// extract vars from params, for convenience
+	host := params.Host
+
+	// create our key
+	ourSK, ourPK, err := crypto.GenerateKeyPair()
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+	ourPublicKey := types.SiaPublicKey{
+		Algorithm: types.SignatureEd25519,
+		Key:       ourPK[:],
+	}
+	// create unlock conditions
+	uc := types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{ourPublicKey, host.PublicKey},
+		SignaturesRequired: 2,
+	}
+
+	// calculate the contract and the cost to the renter
+	fc, renterCost, err := QuoteContract(params)
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+	fc.UnlockHash = uc.UnlockHash()
 
 	// calculate transaction fee
 	_, maxFee := tpool.FeeEstimation()
@@ -0,0 +1,74 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestQuoteContract checks that a quoted contract charges the renter the
+// host's storage price for the requested size and duration, returns the
+// host's collateral, and is a valid file contract.
+func TestQuoteContract(t *testing.T) {
+	var host modules.HostDBEntry
+	host.StoragePrice = types.NewCurrency64(3)
+	host.Collateral = types.NewCurrency64(2)
+	host.MaxCollateral = types.SiacoinPrecision
+	host.ContractPrice = types.NewCurrency64(1e6)
+	host.WindowSize = 20
+	host.UnlockHash = types.UnlockHash{1}
+	params := ContractParams{
+		Host:          host,
+		Filesize:      1 << 20,
+		StartHeight:   100,
+		EndHeight:     1100,
+		RefundAddress: types.UnlockHash{2},
+	}
+
+	fc, renterCost, err := QuoteContract(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := types.NewCurrency64(3 * (1 << 20) * 1000)
+	collateral := types.NewCurrency64(2 * (1 << 20) * 1000)
+	hostPayout := collateral.Add(host.ContractPrice)
+
+	// The renter pays for storage and the contract price, plus the siafund
+	// fee on the whole payout. The host puts up only its collateral.
+	if fc.Payout.Cmp(storage.Add(hostPayout).Mul64(10406).Div64(10000)) != 0 {
+		t.Error("wrong payout:", fc.Payout)
+	}
+	if renterCost.Add(collateral).Cmp(fc.Payout) != 0 {
+		t.Error("renter cost and collateral do not add up to the payout")
+	}
+	if renterCost.Cmp(storage.Add(host.ContractPrice)) <= 0 {
+		t.Error("renter cost does not cover the storage and contract price")
+	}
+	if fc.ValidProofOutputs[1].Value.Cmp(hostPayout) != 0 || fc.ValidProofOutputs[1].UnlockHash != host.UnlockHash {
+		t.Error("host is not paid its collateral and contract price on a valid proof")
+	}
+	if fc.ValidProofOutputs[0].UnlockHash != params.RefundAddress {
+		t.Error("renter refund goes to the wrong address")
+	}
+	if fc.WindowStart != params.EndHeight || fc.WindowEnd != params.EndHeight+host.WindowSize {
+		t.Error("wrong proof window:", fc.WindowStart, fc.WindowEnd)
+	}
+	txn := types.Transaction{FileContracts: []types.FileContract{fc}}
+	if err := txn.StandaloneValid(params.StartHeight); err != nil {
+		t.Error("quoted contract is not valid:", err)
+	}
+
+	// Collateral is capped at the host's MaxCollateral.
+	params.Host.MaxCollateral = types.NewCurrency64(5)
+	fc, renterCost, err = QuoteContract(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fc.ValidProofOutputs[1].Value.Cmp(types.NewCurrency64(5).Add(host.ContractPrice)) != 0 {
+		t.Error("collateral was not capped:", fc.ValidProofOutputs[1].Value)
+	}
+	if renterCost.Add(types.NewCurrency64(5)).Cmp(fc.Payout) != 0 {
+		t.Error("renter cost does not account for the capped collateral")
+	}
+}
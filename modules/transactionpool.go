@@ -78,6 +78,11 @@ type TransactionPool interface {
 	// within 10 blocks.
 	FeeEstimation() (minimumRecommended, maximumRecommended types.Currency)
 
+	// EstimateProofFee returns the miner fee that a storage proof
+	// transaction should pay to be confirmed before its proof window closes,
+	// given the number of blocks left in the window.
+	EstimateProofFee(windowsRemaining types.BlockHeight) types.Currency
+
 	// IsStandardTransaction returns `err = nil` if the transaction is
 	// standard, otherwise it returns an error explaining what is not standard.
 	IsStandardTransaction(types.Transaction) error
@@ -157,6 +157,76 @@ func TestIntegrationCheckMinerFees(t *testing.T) {
 	// TODO: fill the pool up all the way and try again.
 }
 
+// TestProofFeeEstimation checks that EstimateProofFee is free in an empty
+// pool, and follows the fee distribution of a congested pool, paying more as
+// the proof window runs out.
+func TestProofFeeEstimation(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester("TestProofFeeEstimation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Storage proofs need no fee in an empty pool, however close the deadline.
+	for _, remaining := range []types.BlockHeight{0, proofPriorityWindow, 1000} {
+		if fee := tpt.tpool.EstimateProofFee(remaining); !fee.IsZero() {
+			t.Error("storage proofs should be free in an empty transaction pool:", remaining, fee)
+		}
+	}
+
+	// Congest the pool with sets that pay no fees.
+	for i := 0; i < TransactionPoolSizeForFee/10e3; i++ {
+		arbData := make([]byte, 10e3)
+		copy(arbData, modules.PrefixNonSia[:])
+		_, err = rand.Read(arbData[100:116]) // prevents collisions with other transacitons in the loop.
+		if err != nil {
+			t.Fatal(err)
+		}
+		txn := types.Transaction{ArbitraryData: [][]byte{arbData}}
+		err := tpt.tpool.AcceptTransactionSet([]types.Transaction{txn})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Add a few sets that pay a high fee.
+	highFee := types.SiacoinPrecision.Mul64(1e3)
+	for i := 0; i < 3; i++ {
+		builder := tpt.wallet.StartTransaction()
+		err = builder.FundSiacoins(highFee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		builder.AddMinerFee(highFee)
+		txns, err := builder.Sign(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tpt.tpool.AcceptTransactionSet(txns)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A proof with plenty of time left only needs the fee to enter the pool,
+	// while a proof at its deadline matches the highest paying sets.
+	relaxed := tpt.tpool.EstimateProofFee(1000)
+	median := tpt.tpool.EstimateProofFee(proofPriorityWindow)
+	urgent := tpt.tpool.EstimateProofFee(0)
+	if relaxed.Cmp(TransactionMinFee) != 0 {
+		t.Error("wrong estimate for a distant deadline in a congested pool:", relaxed)
+	}
+	if median.Cmp(relaxed) < 0 {
+		t.Error("estimate fell as the deadline approached:", median, relaxed)
+	}
+	if urgent.Cmp(TransactionMinFee) <= 0 || urgent.Cmp(median) < 0 {
+		t.Error("urgent estimate does not follow the highest paying sets:", urgent, median)
+	}
+}
+
 // TestTransactionSuperset submits a single transaction to the network,
 // followed by a transaction set containing that single transaction.
 func TestIntegrationTransactionSuperset(t *testing.T) {
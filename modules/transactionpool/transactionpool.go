@@ -2,10 +2,12 @@ package transactionpool
 
 import (
 	"errors"
+	"sort"
 
 	"github.com/NebulousLabs/demotemutex"
 
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/types"
@@ -13,6 +15,16 @@ import (
 
 const (
 	dbFilename = "transactionpool.db"
+
+	// proofPriorityWindow is the number of blocks before a proof window
+	// closes at which transaction sets carrying a storage proof for the file
+	// contract start being listed ahead of other transaction sets.
+	proofPriorityWindow = 12
+
+	// proofTransactionSize is the approximate encoded size of a transaction
+	// carrying a single storage proof: a 64 byte segment, a hash set of up to
+	// a few dozen hashes, and the transaction overhead.
+	proofTransactionSize = 1500
 )
 
 var (
@@ -124,13 +136,130 @@ func (tp *TransactionPool) FeeEstimation() (min, max types.Currency) {
 	return types.SiacoinPrecision.Mul64(10).Div64(1e3), types.SiacoinPrecision.Mul64(25).Div64(1e3)
 }
 
+// feeRates sorts the miner fees per byte of the transaction sets in the pool.
+type feeRates []types.Currency
+
+func (fr feeRates) Len() int           { return len(fr) }
+func (fr feeRates) Swap(i, j int)      { fr[i], fr[j] = fr[j], fr[i] }
+func (fr feeRates) Less(i, j int) bool { return fr[i].Cmp(fr[j]) < 0 }
+
+// EstimateProofFee returns the miner fee that a storage proof transaction
+// should pay to be confirmed before its proof window closes, given the number
+// of blocks left in the window. While the pool is below
+// TransactionPoolSizeForFee every set fits in the next block and no fee is
+// needed. Once the pool is congested, the estimate is taken from the fee per
+// byte paid by the sets in the pool: a proof with proofPriorityWindow blocks
+// left matches the median set, and the percentile rises towards the highest
+// paying set as the window runs out and falls as more blocks remain. The
+// estimate is never below the fee needed to enter the pool.
+func (tp *TransactionPool) EstimateProofFee(windowsRemaining types.BlockHeight) types.Currency {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	if tp.transactionListSize <= TransactionPoolSizeForFee {
+		return types.ZeroCurrency
+	}
+
+	var rates feeRates
+	for _, ts := range tp.transactionSets {
+		var feeSum types.Currency
+		for _, txn := range ts {
+			for _, fee := range txn.MinerFees {
+				feeSum = feeSum.Add(fee)
+			}
+		}
+		rates = append(rates, feeSum.Div64(uint64(len(encoding.Marshal(ts)))))
+	}
+	sort.Sort(rates)
+
+	index := uint64(len(rates)) * proofPriorityWindow / (proofPriorityWindow + uint64(windowsRemaining))
+	if index >= uint64(len(rates)) {
+		index = uint64(len(rates)) - 1
+	}
+	fee := rates[index].Mul64(proofTransactionSize)
+	if fee.Cmp(TransactionMinFee) < 0 {
+		return TransactionMinFee
+	}
+	return fee
+}
+
 // TransactionList returns a list of all transactions in the transaction pool.
 // The transactions are provided in an order that can acceptably be put into a
 // block.
 func (tp *TransactionPool) TransactionList() []types.Transaction {
+	return tp.transactionList()
+}
+
+// proofDeadline returns the earliest window end of the file contracts that the
+// transaction set submits storage proofs for. The contracts are taken from
+// the diffs of the set, as a storage proof removes its contract. false is
+// returned if the set contains no storage proofs.
+func proofDeadline(ts []types.Transaction, cc modules.ConsensusChange) (deadline types.BlockHeight, ok bool) {
+	proven := make(map[types.FileContractID]struct{})
+	for _, txn := range ts {
+		for _, sp := range txn.StorageProofs {
+			proven[sp.ParentID] = struct{}{}
+		}
+	}
+	for _, fcd := range cc.FileContractDiffs {
+		_, exists := proven[fcd.ID]
+		if !exists || fcd.Direction != modules.DiffRevert {
+			continue
+		}
+		if !ok || fcd.FileContract.WindowEnd < deadline {
+			deadline = fcd.FileContract.WindowEnd
+			ok = true
+		}
+	}
+	return deadline, ok
+}
+
+// prioritizedSet is a transaction set along with the deadline of the most
+// urgent storage proof in the set. 'urgent' is set if the deadline is within
+// proofPriorityWindow blocks.
+type prioritizedSet struct {
+	txns     []types.Transaction
+	deadline types.BlockHeight
+	urgent   bool
+}
+
+// byProofDeadline sorts transaction sets so that sets containing urgent
+// storage proofs come first, ordered by how soon their proof windows close.
+// All other sets keep their relative order.
+type byProofDeadline []prioritizedSet
+
+func (ps byProofDeadline) Len() int      { return len(ps) }
+func (ps byProofDeadline) Swap(i, j int) { ps[i], ps[j] = ps[j], ps[i] }
+func (ps byProofDeadline) Less(i, j int) bool {
+	if ps[i].urgent != ps[j].urgent {
+		return ps[i].urgent
+	}
+	return ps[i].urgent && ps[i].deadline < ps[j].deadline
+}
+
+// transactionList returns all of the transactions in the transaction pool.
+// Transaction sets are independent of each other, so they can be reordered
+// freely. Sets with storage proofs whose windows close within
+// proofPriorityWindow blocks are placed first, nearest deadline first, so
+// that a congested pool does not cause hosts to miss their proof windows when
+// the miner truncates the list to fit in a block. Proofs with distant
+// deadlines are listed with the other sets, so that they cannot crowd
+// transfers out of blocks.
+func (tp *TransactionPool) transactionList() []types.Transaction {
+	height := tp.consensusSet.Height()
+	var sets byProofDeadline
+	for setID, tSet := range tp.transactionSets {
+		deadline, hasProof := proofDeadline(tSet, tp.transactionSetDiffs[setID])
+		sets = append(sets, prioritizedSet{
+			txns:     tSet,
+			deadline: deadline,
+			urgent:   hasProof && deadline <= height+proofPriorityWindow,
+		})
+	}
+	sort.Stable(sets)
+
 	var txns []types.Transaction
-	for _, tSet := range tp.transactionSets {
-		txns = append(txns, tSet...)
+	for _, set := range sets {
+		txns = append(txns, set.txns...)
 	}
 	return txns
 }
@@ -3,6 +3,8 @@ package transactionpool
 import (
 	"crypto/rand"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"testing"
 
 	"github.com/NebulousLabs/Sia/build"
@@ -140,3 +142,124 @@ func TestIntegrationNewNilInputs(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+// TestTransactionListProofPriority checks that transaction sets containing
+// storage proofs near their deadline are listed before other transaction sets,
+// regardless of fees, with the proof closest to its deadline listed first.
+func TestTransactionListProofPriority(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester("TestTransactionListProofPriority")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Step past the hardfork that allows empty storage proofs.
+	for tpt.cs.Height() <= 10 {
+		_, err = tpt.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Create two empty file contracts with the same window start but
+	// different deadlines.
+	builder := tpt.wallet.StartTransaction()
+	payout := types.NewCurrency64(1e9)
+	err = builder.FundSiacoins(payout.Mul64(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, windowEnd := range []types.BlockHeight{tpt.cs.Height() + 10, tpt.cs.Height() + 4} {
+		builder.AddFileContract(types.FileContract{
+			WindowStart:        tpt.cs.Height() + 2,
+			WindowEnd:          windowEnd,
+			Payout:             payout,
+			ValidProofOutputs:  []types.SiacoinOutput{{Value: types.PostTax(tpt.cs.Height(), payout)}},
+			MissedProofOutputs: []types.SiacoinOutput{{Value: types.PostTax(tpt.cs.Height(), payout)}},
+		})
+	}
+	tSet, err := builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(tSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	laterID := tSet[len(tSet)-1].FileContractID(0)
+	soonerID := tSet[len(tSet)-1].FileContractID(1)
+	for i := 0; i < 2; i++ {
+		_, err = tpt.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Submit the proof with the later deadline, then a transfer with a large
+	// fee, then the proof with the sooner deadline.
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{{
+		StorageProofs: []types.StorageProof{{ParentID: laterID}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder = tpt.wallet.StartTransaction()
+	fee := types.SiacoinPrecision.Mul64(50)
+	err = builder.FundSiacoins(fee.Add(types.SiacoinPrecision))
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.AddMinerFee(fee)
+	builder.AddSiacoinOutput(types.SiacoinOutput{Value: types.SiacoinPrecision})
+	tSet, err = builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(tSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{{
+		StorageProofs: []types.StorageProof{{ParentID: soonerID}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txns := tpt.tpool.TransactionList()
+	if len(txns) != 2+len(tSet) {
+		t.Fatal("unexpected number of transactions in the pool:", len(txns))
+	}
+	if len(txns[0].StorageProofs) != 1 || txns[0].StorageProofs[0].ParentID != soonerID {
+		t.Error("the proof with the sooner deadline was not listed first")
+	}
+	if len(txns[1].StorageProofs) != 1 || txns[1].StorageProofs[0].ParentID != laterID {
+		t.Error("the proof with the later deadline was not listed second")
+	}
+}
+
+// TestProofDeadlineOrder checks that byProofDeadline only moves urgent storage
+// proofs ahead of other transaction sets, and leaves the rest in place.
+func TestProofDeadlineOrder(t *testing.T) {
+	transfer := []types.Transaction{{ArbitraryData: [][]byte{{0}}}}
+	distant := []types.Transaction{{ArbitraryData: [][]byte{{1}}}}
+	sooner := []types.Transaction{{ArbitraryData: [][]byte{{2}}}}
+	later := []types.Transaction{{ArbitraryData: [][]byte{{3}}}}
+	sets := byProofDeadline{
+		{txns: transfer},
+		{txns: distant, deadline: 100},
+		{txns: later, deadline: 10, urgent: true},
+		{txns: sooner, deadline: 5, urgent: true},
+	}
+	sort.Stable(sets)
+
+	expected := [][]types.Transaction{sooner, later, transfer, distant}
+	for i := range expected {
+		if !reflect.DeepEqual(sets[i].txns, expected[i]) {
+			t.Errorf("set %v is out of order: %v", i, sets[i].txns[0].ArbitraryData)
+		}
+	}
+}
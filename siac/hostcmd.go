@@ -203,6 +203,7 @@ Host Financials:
 	Contract Count:               %v
 	Transaction Fee Compensation: %v
 	Transaction Fee Expenses:     %v
+	Treasury Expenses:            %v
 
 	Storage Revenue:           %v
 	Potential Storage Revenue: %v
@@ -243,6 +244,7 @@ RPC Stats:
 
 			fm.ContractCount, currencyUnits(fm.ContractCompensation),
 			currencyUnits(fm.TransactionFeeExpenses),
+			currencyUnits(fm.TreasuryExpenses),
 
 			currencyUnits(fm.StorageRevenue),
 			currencyUnits(fm.PotentialStorageRevenue),
@@ -63,17 +63,22 @@ func CalculateCoinbase(height BlockHeight) Currency {
 }
 
 // CalculateNumSiacoins calculates the number of siacoins in circulation at a
-// given height.
+// given height, including the genesis siacoin allocation.
 func CalculateNumSiacoins(height BlockHeight) Currency {
+	genesisSiacoins := NewCurrency64(0)
+	for _, sco := range GenesisSiacoinAllocation {
+		genesisSiacoins = genesisSiacoins.Add(sco.Value)
+	}
+
 	deflationBlocks := BlockHeight(InitialCoinbase - MinimumCoinbase)
 	avgDeflationSiacoins := CalculateCoinbase(0).Add(CalculateCoinbase(height)).Div(NewCurrency64(2))
 	if height <= deflationBlocks {
 		deflationSiacoins := avgDeflationSiacoins.Mul(NewCurrency64(uint64(height + 1)))
-		return deflationSiacoins
+		return genesisSiacoins.Add(deflationSiacoins)
 	}
 	deflationSiacoins := avgDeflationSiacoins.Mul(NewCurrency64(uint64(deflationBlocks + 1)))
 	trailingSiacoins := NewCurrency64(uint64(height - deflationBlocks)).Mul(CalculateCoinbase(height))
-	return deflationSiacoins.Add(trailingSiacoins)
+	return genesisSiacoins.Add(deflationSiacoins).Add(trailingSiacoins)
 }
 
 // ID returns the ID of a Block, which is calculated by hashing the header.
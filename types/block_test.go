@@ -39,15 +39,19 @@ func TestCalculateCoinbase(t *testing.T) {
 // determining the number of siacoins in circulation. The check is performed by
 // doing a naive computation, instead of by doing the optimized computation.
 func TestCalculateNumSiacoins(t *testing.T) {
+	genesisSiacoins := NewCurrency64(0)
+	for _, sco := range GenesisSiacoinAllocation {
+		genesisSiacoins = genesisSiacoins.Add(sco.Value)
+	}
 	c := CalculateNumSiacoins(0)
-	if c.Cmp(CalculateCoinbase(0)) != 0 {
+	if c.Cmp(genesisSiacoins.Add(CalculateCoinbase(0))) != 0 {
 		t.Error("unexpected circulation result for value 0, got", c)
 	}
 
 	if testing.Short() {
 		t.SkipNow()
 	}
-	totalCoins := NewCurrency64(0)
+	totalCoins := genesisSiacoins
 	for i := BlockHeight(0); i < 500e3; i++ {
 		totalCoins = totalCoins.Add(CalculateCoinbase(i))
 		if totalCoins.Cmp(CalculateNumSiacoins(i)) != 0 {
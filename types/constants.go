@@ -33,6 +33,16 @@ var (
 	InitialCoinbase  = uint64(300e3)
 	MinimumCoinbase  uint64
 
+	// TreasuryPortion is the fraction of every valid proof output that is
+	// diverted to TreasuryUnlockHash. A portion of zero disables the
+	// treasury. Both are consensus rules, and are set per release below.
+	TreasuryPortion    *big.Rat
+	TreasuryUnlockHash UnlockHash
+
+	// GenesisSiacoinAllocation lists the siacoin outputs created by the
+	// genesis block. The allocation is empty on all of the built-in networks,
+	// but lets other networks fund specific addresses from the start.
+	GenesisSiacoinAllocation []SiacoinOutput
 	GenesisSiafundAllocation []SiafundOutput
 	GenesisBlock             Block
 
@@ -63,6 +73,8 @@ func init() {
 
 		MinimumCoinbase = 30e3
 
+		TreasuryPortion = big.NewRat(0, 1) // The treasury is disabled.
+
 		GenesisSiafundAllocation = []SiafundOutput{
 			{
 				Value:      NewCurrency64(2000),
@@ -97,6 +109,11 @@ func init() {
 
 		MinimumCoinbase = 299990 // Minimum coinbase is hit after 10 blocks to make testing minimum-coinbase code easier.
 
+		// The treasury is enabled so that the split of the valid proof outputs
+		// is exercised by every test that submits a storage proof.
+		TreasuryPortion = big.NewRat(1, 100)
+		TreasuryUnlockHash = UnlockHash{116, 114, 101, 97, 115, 117, 114, 121}
+
 		GenesisSiafundAllocation = []SiafundOutput{
 			{
 				Value:      NewCurrency64(2000),
@@ -174,6 +191,9 @@ func init() {
 		// or less permanently settles around 2%.
 		MinimumCoinbase = 30e3
 
+		// The treasury is disabled on the full network.
+		TreasuryPortion = big.NewRat(0, 1)
+
 		GenesisSiafundAllocation = []SiafundOutput{
 			{
 				Value:      NewCurrency64(2),
@@ -370,7 +390,10 @@ func init() {
 	GenesisBlock = Block{
 		Timestamp: GenesisTimestamp,
 		Transactions: []Transaction{
-			{SiafundOutputs: GenesisSiafundAllocation},
+			{
+				SiacoinOutputs: GenesisSiacoinAllocation,
+				SiafundOutputs: GenesisSiafundAllocation,
+			},
 		},
 	}
 	// Calculate the genesis ID.
@@ -4,6 +4,8 @@ package types
 // contracts.
 
 import (
+	"math/big"
+
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 )
@@ -93,6 +95,13 @@ type (
 	ProofStatus bool
 )
 
+// Fingerprint returns a hash covering every field of the file contract. Nodes
+// that agree on the state of a file contract produce the same fingerprint, so
+// fingerprints can be compared to find a file contract that has diverged.
+func (fc FileContract) Fingerprint() crypto.Hash {
+	return crypto.HashObject(fc)
+}
+
 // StorageProofOutputID returns the ID of an output created by a file
 // contract, given the status of the storage proof. The ID is calculating by
 // hashing the concatenation of the StorageProofOutput Specifier, the ID of
@@ -108,6 +117,33 @@ func (fcid FileContractID) StorageProofOutputID(proofStatus ProofStatus, i uint6
 	))
 }
 
+// StorageProofTreasuryOutputID returns the ID of the treasury output that is
+// split off of the i'th valid proof output of a file contract. The ID is
+// calculated by hashing the concatenation of the TreasuryOutput Specifier, the
+// ID of the file contract, and the index of the valid proof output.
+func (fcid FileContractID) StorageProofTreasuryOutputID(i uint64) SiacoinOutputID {
+	return SiacoinOutputID(crypto.HashAll(
+		SpecifierTreasuryOutput,
+		fcid,
+		i,
+	))
+}
+
+// TreasuryCut returns the amount of a valid proof output that is diverted to
+// the treasury. The cut is always zero when the treasury is disabled.
+func TreasuryCut(value Currency) Currency {
+	return treasuryCut(value, TreasuryPortion)
+}
+
+// treasuryCut returns the portion of 'value' that is diverted to a treasury
+// that takes 'portion' of each valid proof output.
+func treasuryCut(value Currency, portion *big.Rat) Currency {
+	if portion == nil || portion.Sign() == 0 {
+		return ZeroCurrency
+	}
+	return value.MulRat(portion)
+}
+
 // PostTax returns the amount of currency remaining in a file contract payout
 // after tax.
 func PostTax(height BlockHeight, payout Currency) Currency {
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"math/big"
 	"testing"
 )
 
@@ -37,3 +38,34 @@ func TestTax(t *testing.T) {
 		}
 	}
 }
+
+// TestTreasuryCut probes the TreasuryCut function.
+func TestTreasuryCut(t *testing.T) {
+	// A disabled treasury should never take a cut.
+	if !treasuryCut(NewCurrency64(1e9), big.NewRat(0, 1)).IsZero() {
+		t.Error("disabled treasury is taking a cut")
+	}
+	if !treasuryCut(NewCurrency64(1e9), nil).IsZero() {
+		t.Error("nil treasury portion is taking a cut")
+	}
+
+	// The cut should round down, and the remainder should always sum with the
+	// cut to the original value.
+	portion := big.NewRat(1, 3)
+	if treasuryCut(NewCurrency64(10), portion).Cmp(NewCurrency64(3)) != 0 {
+		t.Error("treasury cut is being calculated incorrectly")
+	}
+	for i := uint64(0); i < 1e3; i++ {
+		val := NewCurrency64((1e3 * i) + i)
+		cut := treasuryCut(val, portion)
+		if val.Sub(cut).Add(cut).Cmp(val) != 0 || cut.Cmp(val) > 0 {
+			t.Error("treasury cut inconsistent for", i)
+		}
+	}
+
+	// TreasuryCut should use the portion of the current release.
+	val := NewCurrency64(1e9)
+	if TreasuryCut(val).Cmp(treasuryCut(val, TreasuryPortion)) != 0 {
+		t.Error("TreasuryCut is not using TreasuryPortion")
+	}
+}
@@ -27,6 +27,7 @@ var (
 	SpecifierFileContractRevision = Specifier{'f', 'i', 'l', 'e', ' ', 'c', 'o', 'n', 't', 'r', 'a', 'c', 't', ' ', 'r', 'e'}
 	SpecifierStorageProof         = Specifier{'s', 't', 'o', 'r', 'a', 'g', 'e', ' ', 'p', 'r', 'o', 'o', 'f'}
 	SpecifierStorageProofOutput   = Specifier{'s', 't', 'o', 'r', 'a', 'g', 'e', ' ', 'p', 'r', 'o', 'o', 'f'}
+	SpecifierTreasuryOutput       = Specifier{'t', 'r', 'e', 'a', 's', 'u', 'r', 'y', ' ', 'o', 'u', 't', 'p', 'u', 't'}
 	SpecifierSiafundInput         = Specifier{'s', 'i', 'a', 'f', 'u', 'n', 'd', ' ', 'i', 'n', 'p', 'u', 't'}
 	SpecifierSiafundOutput        = Specifier{'s', 'i', 'a', 'f', 'u', 'n', 'd', ' ', 'o', 'u', 't', 'p', 'u', 't'}
 	SpecifierClaimOutput          = Specifier{'c', 'l', 'a', 'i', 'm', ' ', 'o', 'u', 't', 'p', 'u', 't'}
@@ -169,6 +170,12 @@ func (t Transaction) SiacoinOutputID(i uint64) SiacoinOutputID {
 // is calculated by hashing the concatenation of the FileContract Specifier,
 // all of the fields in the transaction (except the signatures), and the
 // contract index.
+//
+// Because the signatures are excluded, the ID is fixed once every other field
+// of the transaction is final, and can be computed before the transaction is
+// signed or broadcast. Altering any other field, such as adding a miner fee or
+// another input, will change the ID. The consensus set uses this same ID when
+// the transaction is included in a block.
 func (t Transaction) FileContractID(i uint64) FileContractID {
 	return FileContractID(crypto.HashAll(
 		SpecifierFileContract,